@@ -0,0 +1,39 @@
+package main
+
+import (
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/service"
+)
+
+// newArmedSensor creates the occupancy sensor service reporting whether the
+// timer called name is counting down. It is named so the Home app can tell it
+// apart from the timer's main service.
+func newArmedSensor(name string) *service.OccupancySensor {
+	s := service.NewOccupancySensor()
+
+	n := characteristic.NewName()
+	n.SetValue(name + " armed")
+	s.AddC(n.C)
+
+	return s
+}
+
+// bindArmed adds the armed sensor to the timer's accessory and updates it on
+// every change of the timer, so Reset, Stop and fires from HomeKit, HTTP and
+// schedules are all reflected.
+func (nt *namedTimer) bindArmed() {
+	nt.Armed = newArmedSensor(nt.Name)
+	nt.A.AddS(nt.Armed.S)
+	nt.Timer.OnChange(nt.syncArmed)
+}
+
+// syncArmed updates the armed sensor to the timer status: occupancy is
+// detected while the timer is armed, and not while it is idle, paused, fired
+// or cancelled.
+func (nt *namedTimer) syncArmed(status TimerStatus) {
+	if status.State == StateArmed {
+		nt.Armed.OccupancyDetected.SetValue(characteristic.OccupancyDetectedOccupancyDetected)
+	} else {
+		nt.Armed.OccupancyDetected.SetValue(characteristic.OccupancyDetectedOccupancyNotDetected)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"github.com/brutella/hap"
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/service"
+
+	"testing"
+	"time"
+)
+
+// TestArmedSensorOptional verifies the armed sensor is only added when configured
+func TestArmedSensorOptional(t *testing.T) {
+	nt := newNamedTimer(defaultTimerName, hap.NewMemStore(), timerConfig{})
+	if nt.Armed != nil {
+		t.Error("Armed sensor added without ArmedSensor")
+	}
+
+	for _, typ := range []string{accessorySwitch, accessoryValve} {
+		nt := newNamedTimer(defaultTimerName, hap.NewMemStore(), timerConfig{Accessory: typ, ArmedSensor: true})
+		found := false
+		for _, s := range nt.A.Ss {
+			if s == nt.Armed.S && s.Type == service.TypeOccupancySensor {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Accessory %s has no armed sensor service", typ)
+		}
+	}
+}
+
+// TestArmedSensorFollowsTimer verifies the armed sensor is detected only while the countdown runs
+func TestArmedSensorFollowsTimer(t *testing.T) {
+	clock := newFakeClock(testEpoch)
+	nt := newNamedTimer(defaultTimerName, hap.NewMemStore(), timerConfig{ArmedSensor: true, Clock: clock})
+	armed := func() bool {
+		return nt.Armed.OccupancyDetected.Value() == characteristic.OccupancyDetectedOccupancyDetected
+	}
+
+	if armed() {
+		t.Error("Armed while idle")
+	}
+	nt.Timer.Reset(time.Minute)
+	if !armed() {
+		t.Error("Not armed after Reset")
+	}
+	nt.Timer.Pause()
+	if armed() {
+		t.Error("Armed while paused")
+	}
+	nt.Timer.Resume()
+	if !armed() {
+		t.Error("Not armed after Resume")
+	}
+	nt.Timer.Stop()
+	if armed() {
+		t.Error("Armed after Stop")
+	}
+
+	nt.Timer.Reset(time.Minute)
+	clock.Advance(time.Minute)
+	if armed() {
+		t.Error("Armed after firing")
+	}
+}
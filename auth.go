@@ -0,0 +1,207 @@
+package main
+
+import (
+	"github.com/brutella/hap"
+
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// tokenScope is what an API token allows. Each scope includes the ones below it.
+type tokenScope int
+
+// Token scopes
+const (
+	scopeNone    tokenScope = iota
+	scopeRead               // GET requests: timer status, schedules, events and webhooks
+	scopeControl            // All other timer requests: setting, cancelling, pausing and schedules
+	scopeAdmin              // The /admin endpoints
+)
+
+// scopeNames maps scope names in token lists to scopes.
+var scopeNames = map[string]tokenScope{
+	"read":    scopeRead,
+	"control": scopeControl,
+	"admin":   scopeAdmin,
+}
+
+func (s tokenScope) String() string {
+	for name, scope := range scopeNames {
+		if scope == s {
+			return name
+		}
+	}
+	return "none"
+}
+
+// apiToken is a configured token. Only its hash is kept, so comparisons take
+// the same time whatever the length of the token given.
+type apiToken struct {
+	hash  [sha256.Size]byte
+	scope tokenScope
+}
+
+// apiTokens are the bearer tokens accepted by the HTTP API.
+//
+// Without read or control tokens the timer endpoints are open, as before
+// authentication was added; without admin tokens the /admin endpoints are
+// disabled.
+type apiTokens struct {
+	tokens []apiToken
+}
+
+// Add accepts token for scope. Empty tokens are ignored.
+func (at *apiTokens) Add(token string, scope tokenScope) {
+	if token != "" {
+		at.tokens = append(at.tokens, apiToken{sha256.Sum256([]byte(token)), scope})
+	}
+}
+
+// Parse adds the tokens in text, entries like control:s3cret separated by
+// white space or new lines. A # starts a comment up to the end of the line.
+func (at *apiTokens) Parse(text string) error {
+	for _, line := range strings.Split(text, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		for _, entry := range strings.Fields(line) {
+			name, token, ok := strings.Cut(entry, ":")
+			scope := scopeNames[name]
+			if !ok || scope == scopeNone || token == "" {
+				return fmt.Errorf("invalid token entry %q, expected read:, control: or admin: followed by the token", entry)
+			}
+			at.Add(token, scope)
+		}
+	}
+	return nil
+}
+
+// Load adds the tokens in the file at path, see Parse.
+func (at *apiTokens) Load(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := at.Parse(string(b)); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// LoadNvram adds the tokens in the NVRAM variable name, see Parse. An unset
+// variable adds none.
+func (at *apiTokens) LoadNvram(name string) error {
+	value, err := nvramGet(name)
+	if err != nil {
+		return err
+	}
+	if err := at.Parse(value); err != nil {
+		return fmt.Errorf("nvram %s: %w", name, err)
+	}
+	return nil
+}
+
+// Lookup returns the scope of token, or scopeNone if it isn't configured.
+// Every configured token is compared, in constant time.
+func (at *apiTokens) Lookup(token string) tokenScope {
+	hash := sha256.Sum256([]byte(token))
+	scope := scopeNone
+	for _, t := range at.tokens {
+		if subtle.ConstantTimeCompare(hash[:], t.hash[:]) == 1 && t.scope > scope {
+			scope = t.scope
+		}
+	}
+	return scope
+}
+
+// Configured reports whether a token was added for scope exactly.
+func (at *apiTokens) Configured(scope tokenScope) bool {
+	for _, t := range at.tokens {
+		if t.scope == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Open reports whether the timer endpoints are served without a token.
+func (at *apiTokens) Open() bool {
+	return !at.Configured(scopeRead) && !at.Configured(scopeControl)
+}
+
+// Require wraps next so it is only served for requests carrying a bearer
+// token with scope. Requests without a valid token get 401 Unauthorized, and
+// those with a token lacking the scope 403 Forbidden. Without any admin
+// token, admin requests are always forbidden.
+func (at *apiTokens) Require(scope tokenScope, next http.HandlerFunc) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		if scope == scopeAdmin && !at.Configured(scopeAdmin) {
+			http.Error(res, "Admin endpoints disabled", http.StatusForbidden)
+			return
+		}
+		if scope < scopeAdmin && at.Open() {
+			next(res, req)
+			return
+		}
+
+		given, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			securityLog.Printf("Missing token for %s %s from %s", req.Method, req.URL.Path, req.RemoteAddr)
+			res.Header().Set("WWW-Authenticate", `Bearer realm="hktimer"`)
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		granted := at.Lookup(given)
+		switch {
+		case granted == scopeNone:
+			securityLog.Printf("Invalid token for %s %s from %s", req.Method, req.URL.Path, req.RemoteAddr)
+			res.Header().Set("WWW-Authenticate", `Bearer realm="hktimer", error="invalid_token"`)
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+		case granted < scope:
+			securityLog.Printf("Token with scope %s denied %s %s from %s", granted, req.Method, req.URL.Path, req.RemoteAddr)
+			res.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="hktimer", error="insufficient_scope", scope="%s"`, scope))
+			http.Error(res, "Forbidden", http.StatusForbidden)
+		default:
+			next(res, req)
+		}
+	}
+}
+
+// RequireMethod wraps next like Require, needing scopeRead for GET and HEAD
+// requests and scopeControl for all others.
+func (at *apiTokens) RequireMethod(next http.HandlerFunc) http.HandlerFunc {
+	read, control := at.Require(scopeRead, next), at.Require(scopeControl, next)
+	return func(res http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet || req.Method == http.MethodHead {
+			read(res, req)
+		} else {
+			control(res, req)
+		}
+	}
+}
+
+// authMux registers handlers on a hap.ServeMux behind RequireMethod.
+type authMux struct {
+	hap.ServeMux
+	tokens *apiTokens
+}
+
+// Protect returns mux with every handler registered through it requiring a
+// token, see RequireMethod.
+func (at *apiTokens) Protect(mux hap.ServeMux) hap.ServeMux {
+	return authMux{mux, at}
+}
+
+func (m authMux) Handle(pattern string, handler http.Handler) {
+	m.ServeMux.Handle(pattern, m.tokens.RequireMethod(handler.ServeHTTP))
+}
+
+func (m authMux) HandleFunc(pattern string, handler http.HandlerFunc) {
+	m.ServeMux.HandleFunc(pattern, m.tokens.RequireMethod(handler))
+}
+
+func (m authMux) Mount(pattern string, handler http.Handler) {
+	m.ServeMux.Mount(pattern, m.tokens.RequireMethod(handler.ServeHTTP))
+}
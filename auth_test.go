@@ -0,0 +1,191 @@
+package main
+
+import (
+	"github.com/brutella/hap"
+
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestTokens returns tokens with one token per scope
+func newTestTokens() *apiTokens {
+	tokens := &apiTokens{}
+	tokens.Add("reader", scopeRead)
+	tokens.Add("controller", scopeControl)
+	tokens.Add("admin", scopeAdmin)
+	return tokens
+}
+
+// authRequest serves a request with the Authorization header through handler
+func authRequest(handler http.HandlerFunc, method, header string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/timer", nil)
+	if header != "" {
+		req.Header.Set("Authorization", header)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+// TestRequireAdmin verifies the bearer token check of the admin endpoints
+func TestRequireAdmin(t *testing.T) {
+	ok := func(res http.ResponseWriter, req *http.Request) {}
+	testCases := []struct {
+		name   string
+		token  string
+		header string
+		code   int
+	}{
+		{"Disabled", "", "Bearer ", http.StatusForbidden},
+		{"Missing", "secret", "", http.StatusUnauthorized},
+		{"Wrong", "secret", "Bearer wrong", http.StatusUnauthorized},
+		{"Basic", "secret", "Basic secret", http.StatusUnauthorized},
+		{"Valid", "secret", "Bearer secret", http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tokens := &apiTokens{}
+			tokens.Add(tc.token, scopeAdmin)
+			if rec := authRequest(tokens.Require(scopeAdmin, ok), http.MethodGet, tc.header); rec.Code != tc.code {
+				t.Errorf("Status = %d, expected %d", rec.Code, tc.code)
+			}
+		})
+	}
+}
+
+// TestRequireMethod verifies GET needs the read scope and other methods the control scope
+func TestRequireMethod(t *testing.T) {
+	handler := newTestTokens().RequireMethod(func(res http.ResponseWriter, req *http.Request) {})
+	testCases := []struct {
+		method string
+		header string
+		code   int
+		auth   string
+	}{
+		{http.MethodGet, "", http.StatusUnauthorized, `Bearer realm="hktimer"`},
+		{http.MethodGet, "Bearer wrong", http.StatusUnauthorized, `Bearer realm="hktimer", error="invalid_token"`},
+		{http.MethodGet, "Bearer reader", http.StatusOK, ""},
+		{http.MethodHead, "Bearer reader", http.StatusOK, ""},
+		{http.MethodPut, "Bearer reader", http.StatusForbidden, `Bearer realm="hktimer", error="insufficient_scope", scope="control"`},
+		{http.MethodPut, "Bearer controller", http.StatusOK, ""},
+		{http.MethodGet, "Bearer controller", http.StatusOK, ""},
+		{http.MethodDelete, "Bearer admin", http.StatusOK, ""},
+		{http.MethodPost, "", http.StatusUnauthorized, `Bearer realm="hktimer"`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.method+" "+tc.header, func(t *testing.T) {
+			rec := authRequest(handler, tc.method, tc.header)
+			if rec.Code != tc.code {
+				t.Errorf("Status = %d, expected %d", rec.Code, tc.code)
+			}
+			if auth := rec.Header().Get("WWW-Authenticate"); auth != tc.auth {
+				t.Errorf("WWW-Authenticate = %q, expected %q", auth, tc.auth)
+			}
+		})
+	}
+}
+
+// TestRequireMethodOpen verifies the timer API stays open without read or control tokens
+func TestRequireMethodOpen(t *testing.T) {
+	tokens := &apiTokens{}
+	tokens.Add("admin", scopeAdmin)
+	if !tokens.Open() {
+		t.Error("API not open with only an admin token")
+	}
+	handler := tokens.RequireMethod(func(res http.ResponseWriter, req *http.Request) {})
+	if rec := authRequest(handler, http.MethodPut, ""); rec.Code != http.StatusOK {
+		t.Errorf("PUT without token returned status %d, expected %d", rec.Code, http.StatusOK)
+	}
+
+	// A read token closes the control scope too
+	tokens.Add("reader", scopeRead)
+	if rec := authRequest(handler, http.MethodPut, "Bearer reader"); rec.Code != http.StatusForbidden {
+		t.Errorf("PUT with read token returned status %d, expected %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+// TestParseTokens verifies token lists with comments and invalid entries
+func TestParseTokens(t *testing.T) {
+	tokens := &apiTokens{}
+	err := tokens.Parse("# Home Assistant\nread:r1 control:c1\n\n  admin:a:b # colon in token\n")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	for token, scope := range map[string]tokenScope{"r1": scopeRead, "c1": scopeControl, "a:b": scopeAdmin, "x": scopeNone, "": scopeNone} {
+		if got := tokens.Lookup(token); got != scope {
+			t.Errorf("Lookup(%q) = %s, expected %s", token, got, scope)
+		}
+	}
+
+	for _, text := range []string{"r1", "write:w1", "read:", ":r1"} {
+		if err := (&apiTokens{}).Parse(text); err == nil {
+			t.Errorf("Parse(%q) succeeded, expected error", text)
+		}
+	}
+}
+
+// TestLoadTokens verifies tokens are read from files and NVRAM
+func TestLoadTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens")
+	os.WriteFile(path, []byte("read:fromfile\n"), 0o600)
+
+	get := nvramGet
+	defer func() { nvramGet = get }()
+	nvramGet = func(key string) (string, error) {
+		if key == "hktimer_tokens" {
+			return "control:fromnvram", nil
+		}
+		return "", nil
+	}
+
+	tokens := &apiTokens{}
+	if err := tokens.Load(path); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if err := tokens.LoadNvram("hktimer_tokens"); err != nil {
+		t.Fatalf("LoadNvram failed: %v", err)
+	}
+	if tokens.Lookup("fromfile") != scopeRead || tokens.Lookup("fromnvram") != scopeControl {
+		t.Errorf("Tokens not loaded: %+v", tokens)
+	}
+	if err := tokens.Load(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("Load of a missing file succeeded")
+	}
+}
+
+// TestProtect verifies routes registered through a protected mux need tokens
+func TestProtect(t *testing.T) {
+	ts := newTimerSet([]string{defaultTimerName}, hap.NewMemStore(), timerConfig{})
+	server, err := hap.NewServer(hap.NewMemStore(), ts.All()[0].A)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	tokens := newTestTokens()
+	registerTimerSetRoutes(t.Context(), tokens.Protect(server.ServeMux()), ts)
+	handler := server.ServeMux().(http.Handler)
+
+	for _, tc := range []struct {
+		method, path, header string
+		code                 int
+	}{
+		{http.MethodGet, "/timer", "", http.StatusUnauthorized},
+		{http.MethodGet, "/timer", "Bearer reader", http.StatusOK},
+		{http.MethodGet, "/timers", "Bearer reader", http.StatusOK},
+		{http.MethodPost, "/timers/timer/pause", "Bearer reader", http.StatusForbidden},
+		{http.MethodPut, "/timer", "Bearer controller", http.StatusOK},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(`{"seconds": 60}`))
+		if tc.header != "" {
+			req.Header.Set("Authorization", tc.header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tc.code {
+			t.Errorf("%s %s with %q returned status %d, expected %d", tc.method, tc.path, tc.header, rec.Code, tc.code)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Clock is the source of time for timers and schedules, so tests can replace
+// the real clock with one they advance manually.
+type Clock interface {
+	// Now returns the current wall-clock time.
+	Now() time.Time
+	// Elapsed returns the time since an arbitrary fixed point on the
+	// monotonic clock, which is not affected by wall-clock steps.
+	Elapsed() time.Duration
+	// AfterFunc calls f in its own goroutine after duration d has elapsed on
+	// the monotonic clock.
+	AfterFunc(d time.Duration, f func()) ClockTimer
+}
+
+// ClockTimer is a pending AfterFunc call.
+type ClockTimer interface {
+	// Stop prevents the call from running. It returns false if the call has
+	// already run or been stopped.
+	Stop() bool
+}
+
+// realClock is the Clock backed by the time package.
+type realClock struct{}
+
+// realClockStart is the fixed point of realClock.Elapsed.
+var realClockStart = time.Now()
+
+// Now returns time.Now().
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// Elapsed returns the monotonic time since the process started.
+func (realClock) Elapsed() time.Duration {
+	return time.Since(realClockStart)
+}
+
+// AfterFunc wraps time.AfterFunc.
+func (realClock) AfterFunc(d time.Duration, f func()) ClockTimer {
+	return time.AfterFunc(d, f)
+}
+
+// Wall-clock step detection
+const (
+	clockCheckInterval = 10 * time.Second // How often to compare the wall and monotonic clocks
+	clockStepThreshold = 2 * time.Second  // Difference that counts as a step rather than drift
+)
+
+// clockValidAfter is the earliest wall-clock time trusted without an observed
+// step. Routers without a battery-backed clock boot in 1970 or at their
+// firmware build date until NTP syncs.
+var clockValidAfter = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// clockSync tracks whether the wall clock can be trusted and detects steps,
+// such as the jump when NTP first syncs after boot.
+type clockSync struct {
+	clock Clock
+	check func() bool // optional external sync indicator
+
+	mu      sync.Mutex
+	synced  bool
+	wall    time.Time     // wall time at the last check
+	mono    time.Duration // monotonic time at the last check
+	onStep  []func()      // called after a step or when the clock becomes synced
+	waiting []func()      // called once when the clock becomes synced
+}
+
+// newClockSync creates a clockSync for clock. check reports whether an
+// external source (like the router's NTP client) has synced the clock; if it
+// is nil, any time after clockValidAfter is trusted.
+func newClockSync(clock Clock, check func() bool) *clockSync {
+	c := &clockSync{
+		clock: clock,
+		check: check,
+		wall:  clock.Now(),
+		mono:  clock.Elapsed(),
+	}
+	c.synced = c.trusted(c.wall)
+	return c
+}
+
+// trusted reports whether wall looks like a synced time.
+func (c *clockSync) trusted(wall time.Time) bool {
+	if c.check != nil {
+		return c.check()
+	}
+	return !wall.Before(clockValidAfter)
+}
+
+// Synced reports whether the wall clock can be trusted.
+func (c *clockSync) Synced() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.synced
+}
+
+// OnStep registers fn to be called after every wall-clock step, and when the
+// clock becomes synced.
+func (c *clockSync) OnStep(fn func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onStep = append(c.onStep, fn)
+}
+
+// WhenSynced calls fn once the clock is synced, right away if it already is.
+func (c *clockSync) WhenSynced(fn func()) {
+	c.mu.Lock()
+	if !c.synced {
+		c.waiting = append(c.waiting, fn)
+		c.mu.Unlock()
+		return
+	}
+	c.mu.Unlock()
+	fn()
+}
+
+// Check compares the wall clock against the monotonic clock since the last
+// check. A difference beyond clockStepThreshold is a step, which also marks
+// the clock as synced.
+func (c *clockSync) Check() {
+	wall, mono := c.clock.Now(), c.clock.Elapsed()
+
+	c.mu.Lock()
+	// Round(0) strips the monotonic reading, so Sub compares wall-clock times
+	drift := wall.Round(0).Sub(c.wall.Round(0)) - (mono - c.mono)
+	c.wall, c.mono = wall, mono
+
+	stepped := drift.Abs() > clockStepThreshold
+	wasSynced := c.synced
+	c.synced = c.synced || stepped || c.trusted(wall)
+	if !stepped && c.synced == wasSynced {
+		c.mu.Unlock()
+		return
+	}
+
+	onStep := c.onStep
+	waiting := c.waiting
+	if c.synced {
+		c.waiting = nil
+	} else {
+		waiting = nil
+	}
+	c.mu.Unlock()
+
+	if stepped {
+		log.Printf("Wall clock stepped by %s to %s", drift.Round(time.Second), wall.Format(time.RFC3339))
+	}
+	for _, fn := range waiting {
+		fn()
+	}
+	for _, fn := range onStep {
+		fn()
+	}
+}
+
+// Run checks the clock every clockCheckInterval until ctx is cancelled.
+func (c *clockSync) Run(ctx context.Context) {
+	tick := make(chan struct{}, 1)
+	for {
+		timer := c.clock.AfterFunc(clockCheckInterval, func() { tick <- struct{}{} })
+		select {
+		case <-tick:
+			c.Check()
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
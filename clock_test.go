@@ -0,0 +1,210 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock for tests that only moves when advanced.
+// Calls scheduled with AfterFunc run synchronously from Advance, in order of
+// their due time, so tests observe their effects without sleeping. Step moves
+// the wall clock alone, like an NTP sync.
+type fakeClock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond // signalled when timers are added
+	now     time.Time
+	elapsed time.Duration
+	pending []*fakeTimer
+}
+
+// fakeTimer is a pending AfterFunc call of a fakeClock.
+type fakeTimer struct {
+	clock *fakeClock
+	at    time.Duration // due on the monotonic clock
+	f     func()
+}
+
+// newFakeClock creates a fake clock starting at now.
+func newFakeClock(now time.Time) *fakeClock {
+	c := &fakeClock{now: now}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now returns the fake wall-clock time.
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Elapsed returns how far the clock has been advanced.
+func (c *fakeClock) Elapsed() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.elapsed
+}
+
+// AfterFunc schedules f to run once the clock is advanced by d.
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) ClockTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, at: c.elapsed + d, f: f}
+	c.pending = append(c.pending, t)
+	c.cond.Broadcast()
+	return t
+}
+
+// Advance moves the clock forward by d, running the calls that become due.
+// Each call sees the clock at its own due time.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.elapsed + d
+	for {
+		sort.SliceStable(c.pending, func(i, j int) bool { return c.pending[i].at < c.pending[j].at })
+		if len(c.pending) == 0 || c.pending[0].at > end {
+			break
+		}
+		t := c.pending[0]
+		c.pending = c.pending[1:]
+		if t.at > c.elapsed {
+			c.now = c.now.Add(t.at - c.elapsed)
+			c.elapsed = t.at
+		}
+
+		// Run without the lock, as the call may use the clock
+		c.mu.Unlock()
+		t.f()
+		c.mu.Lock()
+	}
+	c.now = c.now.Add(end - c.elapsed)
+	c.elapsed = end
+	c.mu.Unlock()
+}
+
+// Step moves the wall clock by d without any time elapsing.
+func (c *fakeClock) Step(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Pending returns the number of calls that haven't run or been stopped.
+func (c *fakeClock) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.pending)
+}
+
+// WaitPending blocks until at least n calls are pending, for code that
+// schedules calls from another goroutine.
+func (c *fakeClock) WaitPending(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.pending) < n {
+		c.cond.Wait()
+	}
+}
+
+// Stop removes the call from the clock.
+func (t *fakeTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, p := range c.pending {
+		if p == t {
+			c.pending = append(c.pending[:i], c.pending[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// TestFakeClock verifies the fake clock runs due calls in order and skips stopped ones
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)
+	c := newFakeClock(start)
+
+	var calls []time.Duration
+	record := func() { calls = append(calls, c.Now().Sub(start)) }
+	c.AfterFunc(2*time.Second, record)
+	c.AfterFunc(time.Second, record)
+	stopped := c.AfterFunc(time.Second, record)
+	c.AfterFunc(time.Hour, record)
+
+	if !stopped.Stop() {
+		t.Error("Stop returned false for a pending call")
+	}
+	if stopped.Stop() {
+		t.Error("Second Stop returned true")
+	}
+
+	c.Advance(time.Minute)
+	if len(calls) != 2 || calls[0] != time.Second || calls[1] != 2*time.Second {
+		t.Errorf("Calls at %v, expected [1s 2s]", calls)
+	}
+	if now := c.Now(); !now.Equal(start.Add(time.Minute)) {
+		t.Errorf("Now = %v, expected %v", now, start.Add(time.Minute))
+	}
+	if c.Pending() != 1 {
+		t.Errorf("Pending = %d, expected 1", c.Pending())
+	}
+}
+
+// TestClockSyncStep verifies a wall-clock step is detected and marks the clock synced
+func TestClockSyncStep(t *testing.T) {
+	boot := time.Date(1970, 1, 1, 0, 0, 30, 0, time.UTC)
+	c := newFakeClock(boot)
+	cs := newClockSync(c, nil)
+	if cs.Synced() {
+		t.Fatal("Clock at 1970 reported as synced")
+	}
+
+	var steps, waited int
+	cs.OnStep(func() { steps++ })
+	cs.WhenSynced(func() { waited++ })
+
+	// Regular ticks are not steps
+	c.Advance(clockCheckInterval)
+	cs.Check()
+	if steps != 0 || cs.Synced() {
+		t.Errorf("After tick, steps = %d, synced = %v; expected 0, false", steps, cs.Synced())
+	}
+
+	c.Step(testEpoch.Sub(c.Now()))
+	cs.Check()
+	if steps != 1 || waited != 1 || !cs.Synced() {
+		t.Errorf("After step, steps = %d, waited = %d, synced = %v; expected 1, 1, true", steps, waited, cs.Synced())
+	}
+
+	// Later steps notify again, but WhenSynced callbacks only run once
+	c.Step(-time.Hour)
+	cs.Check()
+	if steps != 2 || waited != 1 {
+		t.Errorf("After second step, steps = %d, waited = %d; expected 2, 1", steps, waited)
+	}
+
+	ran := false
+	cs.WhenSynced(func() { ran = true })
+	if !ran {
+		t.Error("WhenSynced did not run right away on a synced clock")
+	}
+}
+
+// TestClockSyncCheck verifies an external sync indicator overrides the date heuristic
+func TestClockSyncCheck(t *testing.T) {
+	c := newFakeClock(testEpoch)
+	ready := false
+	cs := newClockSync(c, func() bool { return ready })
+	if cs.Synced() {
+		t.Fatal("Clock reported as synced before the indicator")
+	}
+
+	ready = true
+	cs.Check()
+	if !cs.Synced() {
+		t.Error("Clock not synced after the indicator")
+	}
+}
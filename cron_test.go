@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestParseCronInvalid verifies malformed expressions are rejected
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * FOO *",
+		"@often",
+	} {
+		if _, err := parseCron(expr); !errors.Is(err, errInvalidCron) {
+			t.Errorf("parseCron(%q) error = %v, expected invalid cron expression", expr, err)
+		}
+	}
+}
+
+// TestCronNext verifies the next match for a range of expressions
+func TestCronNext(t *testing.T) {
+	// Thursday
+	from := time.Date(2026, 1, 15, 10, 20, 30, 0, time.UTC)
+
+	testCases := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2026, 1, 15, 10, 21, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 1, 15, 10, 30, 0, 0, time.UTC)},
+		{"30 7 * * *", time.Date(2026, 1, 16, 7, 30, 0, 0, time.UTC)},
+		{"0 8-18/2 * * *", time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)},
+		{"0 9 * * MON-FRI", time.Date(2026, 1, 16, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * sat,sun", time.Date(2026, 1, 17, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 7", time.Date(2026, 1, 18, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2026, 1, 15, 11, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// Day of month or day of week when both are restricted
+		{"0 0 20 * MON", time.Date(2026, 1, 19, 0, 0, 0, 0, time.UTC)},
+		// A starred step doesn't restrict the day of month
+		{"0 0 */2 * MON", time.Date(2026, 1, 19, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.expr, func(t *testing.T) {
+			c, err := parseCron(tc.expr)
+			if err != nil {
+				t.Fatalf("parseCron failed: %v", err)
+			}
+			if next := c.Next(from); !next.Equal(tc.expected) {
+				t.Errorf("Next = %v, expected %v", next, tc.expected)
+			}
+		})
+	}
+}
+
+// TestCronNextNever verifies an impossible date yields the zero time
+func TestCronNextNever(t *testing.T) {
+	c, err := parseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("parseCron failed: %v", err)
+	}
+	if next := c.Next(time.Now()); !next.IsZero() {
+		t.Errorf("Next = %v, expected zero time", next)
+	}
+}
+
+// TestCronNextLocation verifies matching uses wall-clock time across DST changes
+func TestCronNextLocation(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("Time zone data not available: %v", err)
+	}
+
+	c, err := parseCron("30 7 * * *")
+	if err != nil {
+		t.Fatalf("parseCron failed: %v", err)
+	}
+
+	// Clocks go forward on 29 March 2026
+	from := time.Date(2026, 3, 28, 8, 0, 0, 0, loc)
+	expected := time.Date(2026, 3, 29, 7, 30, 0, 0, loc)
+	if next := c.Next(from); !next.Equal(expected) {
+		t.Errorf("Next = %v, expected %v", next, expected)
+	}
+}
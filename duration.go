@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errInvalidDuration is returned for durations in none of the accepted formats.
+var errInvalidDuration = errors.New("invalid duration")
+
+// invalidDurationMessage tells clients which duration formats are accepted.
+const invalidDurationMessage = "Invalid duration, use seconds like 5400, a duration like 1h30m, or ISO 8601 like PT1H30M"
+
+// isoDurationPattern matches ISO 8601 durations in weeks, days, hours,
+// minutes and seconds, like PT1H30M. Years and months are left out, as their
+// length varies.
+var isoDurationPattern = regexp.MustCompile(`^(-)?P(?:(\d+(?:[.,]\d+)?)W)?(?:(\d+(?:[.,]\d+)?)D)?(?:T(?:(\d+(?:[.,]\d+)?)H)?(?:(\d+(?:[.,]\d+)?)M)?(?:(\d+(?:[.,]\d+)?)S)?)?$`)
+
+// isoDurationUnits are the seconds per unit of the isoDurationPattern groups.
+var isoDurationUnits = []int64{7 * 86400, 86400, 3600, 60, 1}
+
+// timerSeconds is a number of seconds in JSON requests. Besides a number, it
+// accepts a string with a number, a Go duration like "1h30m" or an ISO 8601
+// duration like "PT1H30M", as typed in iOS Shortcuts or dictated.
+type timerSeconds int
+
+func (s *timerSeconds) UnmarshalJSON(b []byte) error {
+	var n int
+	if err := json.Unmarshal(b, &n); err == nil {
+		*s = timerSeconds(n)
+		return nil
+	}
+	var str string
+	if err := json.Unmarshal(b, &str); err != nil {
+		return fmt.Errorf("%w: %s", errInvalidDuration, b)
+	}
+	n, err := parseTimerSeconds(str)
+	if err != nil {
+		return err
+	}
+	*s = timerSeconds(n)
+	return nil
+}
+
+// parseTimerSeconds parses s as a number of seconds, a Go duration or an ISO
+// 8601 duration, which must come to whole seconds. Durations too long for an
+// int saturate, so they fail the range checks like other long durations.
+func parseTimerSeconds(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.Atoi(s); err == nil {
+		return n, nil
+	}
+
+	if iso := strings.ToUpper(s); strings.HasPrefix(strings.TrimPrefix(iso, "-"), "P") {
+		return parseISODuration(iso)
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d%time.Second != 0 {
+		return 0, fmt.Errorf("%w %q", errInvalidDuration, s)
+	}
+	return int(d / time.Second), nil
+}
+
+// parseISODuration parses an ISO 8601 duration, see isoDurationPattern.
+func parseISODuration(s string) (int, error) {
+	m := isoDurationPattern.FindStringSubmatch(s)
+	if m == nil || strings.HasSuffix(s, "P") || strings.HasSuffix(s, "T") {
+		return 0, fmt.Errorf("%w %q", errInvalidDuration, s)
+	}
+
+	total := new(big.Rat)
+	for i, unit := range isoDurationUnits {
+		value := m[i+2]
+		if value == "" {
+			continue
+		}
+		r, ok := new(big.Rat).SetString(strings.Replace(value, ",", ".", 1))
+		if !ok {
+			return 0, fmt.Errorf("%w %q", errInvalidDuration, s)
+		}
+		total.Add(total, r.Mul(r, big.NewRat(unit, 1)))
+	}
+	if !total.IsInt() {
+		return 0, fmt.Errorf("%w %q: not whole seconds", errInvalidDuration, s)
+	}
+
+	n := total.Num()
+	if !n.IsInt64() || n.Int64() > math.MaxInt32 {
+		n.SetInt64(math.MaxInt32)
+	}
+	if m[1] == "-" {
+		return -int(n.Int64()), nil
+	}
+	return int(n.Int64()), nil
+}
+
+// formatSeconds formats seconds as a Go duration without zero trailing units,
+// like 1h30m, which PUT requests accept back.
+func formatSeconds(seconds int) string {
+	s := (time.Duration(seconds) * time.Second).String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
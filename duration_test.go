@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+// TestParseTimerSeconds verifies numbers, Go durations and ISO 8601 durations
+func TestParseTimerSeconds(t *testing.T) {
+	valid := map[string]int{
+		"5400":          5400,
+		" 90 ":          90,
+		"-60":           -60,
+		"90m":           5400,
+		"1h30m":         5400,
+		"1.5h":          5400,
+		"-5m":           -300,
+		"0s":            0,
+		"PT90M":         5400,
+		"PT1H30M":       5400,
+		"pt1h30m":       5400,
+		"PT1,5H":        5400,
+		"PT0.5M":        30,
+		"P1D":           86400,
+		"P1DT12H":       129600,
+		"P2W":           1209600,
+		"-PT5M":         -300,
+		"PT45S":         45,
+		"P99999999999D": math.MaxInt32,
+	}
+	for s, expected := range valid {
+		if n, err := parseTimerSeconds(s); err != nil || n != expected {
+			t.Errorf("parseTimerSeconds(%q) = %d, %v; expected %d", s, n, err, expected)
+		}
+	}
+
+	for _, s := range []string{"", "soon", "90 minutes", "1.5s", "500ms", "P", "PT", "P1DT", "P1Y", "P1M", "PT0.1S", "PT1H1H", "P-1D", "1d"} {
+		if n, err := parseTimerSeconds(s); !errors.Is(err, errInvalidDuration) {
+			t.Errorf("parseTimerSeconds(%q) = %d, %v; expected invalid duration", s, n, err)
+		}
+	}
+}
+
+// TestTimerSecondsJSON verifies seconds are decoded from numbers and strings
+func TestTimerSecondsJSON(t *testing.T) {
+	for body, expected := range map[string]timerSeconds{
+		`{"seconds": 300}`:       300,
+		`{"seconds": "300"}`:     300,
+		`{"seconds": "5m"}`:      300,
+		`{"seconds": "PT5M"}`:    300,
+		`{"seconds": null}`:      0,
+		`{"at": "07:30"}`:        0,
+		`{"seconds": "-PT1M"}`:   -60,
+		`{"seconds": "1h0m30s"}`: 3630,
+	} {
+		var input inputTimer
+		if err := json.Unmarshal([]byte(body), &input); err != nil || timerSeconds(input.seconds()) != expected {
+			t.Errorf("Decoding %s = %d, %v; expected %d", body, input.seconds(), err, expected)
+		}
+	}
+
+	for _, body := range []string{`{"seconds": 1.5}`, `{"seconds": "later"}`, `{"seconds": true}`, `{"seconds": 1e20}`} {
+		var input inputTimer
+		if err := json.Unmarshal([]byte(body), &input); !errors.Is(err, errInvalidDuration) {
+			t.Errorf("Decoding %s returned %v, expected invalid duration", body, err)
+		}
+	}
+}
+
+// TestFormatSeconds verifies durations are shown without zero trailing units
+func TestFormatSeconds(t *testing.T) {
+	for seconds, expected := range map[int]string{
+		0:       "0s",
+		45:      "45s",
+		300:     "5m",
+		330:     "5m30s",
+		3600:    "1h",
+		5400:    "1h30m",
+		3630:    "1h0m30s",
+		2592000: "720h",
+	} {
+		if s := formatSeconds(seconds); s != expected {
+			t.Errorf("formatSeconds(%d) = %q, expected %q", seconds, s, expected)
+		}
+		if n, err := parseTimerSeconds(formatSeconds(seconds)); err != nil || n != seconds {
+			t.Errorf("formatSeconds(%d) parsed back as %d, %v", seconds, n, err)
+		}
+	}
+}
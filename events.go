@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Event types besides the timer states, which report a timer being set,
+// paused, fired or cancelled
+const (
+	eventStatus = "status" // Current status, sent when a client connects
+	eventSwitch = "switch" // The HomeKit switch, or another fire output, changed
+)
+
+// Sources of timer changes, see SecondsTimer.Via
+const (
+	sourceTimer    = "timer"    // hktimer itself: the countdown ran out or a pulse ended
+	sourceClock    = "clock"    // The wall clock stepped; not published, as the timer kept its state
+	sourceSchedule = "schedule" // A schedule was due
+	sourceHomeKit  = "homekit"  // A HomeKit controller changed the switch or valve
+	sourceAPI      = "api"      // An HTTP request
+	sourceRestore  = "restore"  // The timer was restored on startup
+)
+
+// Event stream settings, variables so tests can shorten them
+var (
+	sseKeepalive = 15 * time.Second // Interval of comments keeping idle streams open
+	sseBuffer    = 16               // Events buffered per client before it is dropped as too slow
+)
+
+// timerEvent is a change published to event stream clients.
+type timerEvent struct {
+	Type   string      // Event type, a TimerState or one of the event constants
+	Timer  string      // Timer name; empty for events concerning all timers, like pairings
+	Source string      // What caused a timer event, one of the source constants
+	Data   interface{} // JSON payload
+}
+
+// eventSubscriber is a client of an eventHub.
+type eventSubscriber struct {
+	timer string // only receive events of this timer, and global ones
+	c     chan timerEvent
+}
+
+// eventHub fans out events to subscribers. Publishing never blocks: a
+// subscriber whose buffer is full is dropped and its channel closed, so a
+// stalled client can't hold up timers and HomeKit.
+type eventHub struct {
+	mu        sync.Mutex
+	subs      map[*eventSubscriber]bool
+	listeners []func(e timerEvent) // receive every event, see Listen
+}
+
+// newEventHub creates a hub without subscribers.
+func newEventHub() *eventHub {
+	return &eventHub{subs: make(map[*eventSubscriber]bool)}
+}
+
+// Subscribe returns a channel receiving the events of the timer called name,
+// and global events, with room for buffer events. The channel is closed if the
+// subscriber falls behind. The returned function unsubscribes.
+func (h *eventHub) Subscribe(name string, buffer int) (<-chan timerEvent, func()) {
+	sub := &eventSubscriber{timer: name, c: make(chan timerEvent, buffer)}
+	h.mu.Lock()
+	h.subs[sub] = true
+	h.mu.Unlock()
+
+	return sub.c, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if h.subs[sub] {
+			delete(h.subs, sub)
+			close(sub.c)
+		}
+	}
+}
+
+// Listen registers fn to be called with every event, of all timers, as it is
+// published. fn must not block or publish events itself.
+func (h *eventHub) Listen(fn func(e timerEvent)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.listeners = append(h.listeners, fn)
+}
+
+// Subscribed reports whether anyone is listening, so publishers can skip
+// building events nobody receives.
+func (h *eventHub) Subscribed() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs) > 0 || len(h.listeners) > 0
+}
+
+// Publish sends e to the listeners and matching subscribers without blocking.
+func (h *eventHub) Publish(e timerEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, fn := range h.listeners {
+		fn(e)
+	}
+	for sub := range h.subs {
+		if e.Timer != "" && e.Timer != sub.timer {
+			continue
+		}
+		select {
+		case sub.c <- e:
+		default:
+			log.Printf("Dropping event client of timer %s, buffer full", sub.timer)
+			delete(h.subs, sub)
+			close(sub.c)
+		}
+	}
+}
+
+// publishTimer publishes the status of nt as an event of type typ, caused by
+// status.Source. Changes without a source are attributed to sourceTimer.
+func (nt *namedTimer) publishTimer(typ string, status TimerStatus) {
+	events := nt.config.Events
+	if status.Source == sourceClock || !events.Subscribed() {
+		return
+	}
+	source := status.Source
+	if source == "" {
+		source = sourceTimer
+	}
+	events.Publish(timerEvent{Type: typ, Timer: nt.Name, Source: source, Data: newOutputTimer(nt, status)})
+}
+
+// publishSwitch publishes the output of nt changing, caused by source.
+func (nt *namedTimer) publishSwitch(source string) {
+	status := nt.Timer.Status()
+	status.Source = source
+	nt.publishTimer(eventSwitch, status)
+}
+
+// publishPairing publishes a pairing change to all event clients.
+func (h *eventHub) publishPairing(e pairingEvent) {
+	h.Publish(timerEvent{Type: e.Type, Data: outputPairing{ID: e.ID, Admin: e.Admin}})
+}
+
+// waitEventTimeout is reported by Wait when no change happened in time.
+const waitEventTimeout = "timeout"
+
+// Wait blocks until the state of nt changes, d elapses or ctx is done. It
+// returns what happened, a TimerState or waitEventTimeout, with the status
+// after it, or false if ctx was done first. It listens on the event hub, so
+// the fire event on the timer's channel is left for the goroutine switching
+// the output on.
+func (nt *namedTimer) Wait(ctx context.Context, d time.Duration) (string, TimerStatus, bool) {
+	events, unsubscribe := nt.config.Events.Subscribe(nt.Name, sseBuffer)
+	defer unsubscribe()
+
+	timeout := make(chan struct{})
+	timer := nt.clock.AfterFunc(d, func() { close(timeout) })
+	defer timer.Stop()
+
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				// Dropped after a burst of changes, which is a change too
+				status := nt.Timer.Status()
+				return string(status.State), status, true
+			}
+			if e.Timer == "" || e.Type == eventSwitch {
+				continue
+			}
+			return e.Type, nt.Timer.Status(), true
+		case <-timeout:
+			return waitEventTimeout, nt.Timer.Status(), true
+		case <-ctx.Done():
+			return "", TimerStatus{}, false
+		}
+	}
+}
+
+// eventsHandler streams the changes of nt as Server-Sent Events, starting with
+// its current status. Each event's data has the same fields as GET on the
+// timer. The stream ends when the client disconnects, falls behind, or ctx is
+// cancelled on shutdown.
+func eventsHandler(ctx context.Context, nt *namedTimer) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			log.Printf("HTTP request not supported")
+			http.Error(res, "Not supported", http.StatusNotImplemented)
+			return
+		}
+		log.Printf("GET events request from %s", req.Header.Get("User-Agent"))
+
+		// Subscribe before taking the status, so no change is missed in between
+		events, unsubscribe := nt.config.Events.Subscribe(nt.Name, sseBuffer)
+		defer unsubscribe()
+
+		rc := http.NewResponseController(res)
+		res.Header().Set("Content-Type", "text/event-stream")
+		res.Header().Set("Cache-Control", "no-cache")
+		writeEvent(res, eventStatus, newOutputTimer(nt, nt.Timer.Status()))
+		if err := rc.Flush(); err != nil {
+			log.Printf("Events request failed: %s", err)
+			return
+		}
+
+		keepalive := time.NewTicker(sseKeepalive)
+		defer keepalive.Stop()
+		for {
+			select {
+			case e, ok := <-events:
+				if !ok {
+					// Dropped as too slow; the client reconnects for a fresh status
+					return
+				}
+				writeEvent(res, e.Type, e.Data)
+			case <-keepalive.C:
+				fmt.Fprint(res, ": keepalive\n\n")
+			case <-req.Context().Done():
+				return
+			case <-ctx.Done():
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeEvent writes one Server-Sent Event of type typ with data as JSON.
+func writeEvent(res http.ResponseWriter, typ string, data interface{}) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Failed to encode %s event: %s", typ, err)
+		return
+	}
+	fmt.Fprintf(res, "event: %s\ndata: %s\n\n", typ, b)
+}
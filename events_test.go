@@ -0,0 +1,253 @@
+package main
+
+import (
+	"github.com/brutella/hap"
+
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestEventHub verifies events reach matching subscribers and slow ones are dropped
+func TestEventHub(t *testing.T) {
+	h := newEventHub()
+	if h.Subscribed() {
+		t.Error("New hub reports subscribers")
+	}
+	a, unsubscribeA := h.Subscribe("a", 1)
+	b, unsubscribeB := h.Subscribe("b", 2)
+	defer unsubscribeB()
+
+	h.Publish(timerEvent{Type: "armed", Timer: "b"})
+	h.Publish(timerEvent{Type: pairingPaired})
+	if e := <-b; e.Type != "armed" {
+		t.Errorf("First event of b = %s, expected armed", e.Type)
+	}
+	if e := <-b; e.Type != pairingPaired {
+		t.Errorf("Second event of b = %s, expected %s", e.Type, pairingPaired)
+	}
+	if e := <-a; e.Type != pairingPaired {
+		t.Errorf("Event of a = %s, expected only the global %s", e.Type, pairingPaired)
+	}
+
+	// a has room for one event, the second drops it
+	h.Publish(timerEvent{Type: "armed", Timer: "a"})
+	h.Publish(timerEvent{Type: "fired", Timer: "a"})
+	<-a
+	if _, ok := <-a; ok {
+		t.Error("Slow subscriber not dropped")
+	}
+	unsubscribeA() // must not close twice
+
+	unsubscribeB()
+	if h.Subscribed() {
+		t.Error("Hub reports subscribers after unsubscribing")
+	}
+}
+
+// readEvents collects the events of an SSE stream on a channel
+func readEvents(t *testing.T, res *http.Response) <-chan [2]string {
+	t.Helper()
+	events := make(chan [2]string, 16)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(res.Body)
+		var typ string
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				typ = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				events <- [2]string{typ, strings.TrimPrefix(line, "data: ")}
+			case strings.HasPrefix(line, ":"):
+				events <- [2]string{"keepalive", ""}
+			}
+		}
+	}()
+	return events
+}
+
+// nextEvent returns the next event of the stream, skipping keepalives and
+// failing after a second
+func nextEvent(t *testing.T, events <-chan [2]string) (string, outputTimer) {
+	t.Helper()
+	deadline := time.After(time.Second)
+	for {
+		var e [2]string
+		var ok bool
+		select {
+		case e, ok = <-events:
+		case <-deadline:
+			t.Fatal("No event received")
+		}
+		if !ok {
+			t.Fatal("Event stream ended")
+		}
+		if e[0] == "keepalive" {
+			continue
+		}
+		var out outputTimer
+		if e[1] != "" {
+			if err := json.Unmarshal([]byte(e[1]), &out); err != nil {
+				t.Fatalf("Failed to parse event data %q: %v", e[1], err)
+			}
+		}
+		return e[0], out
+	}
+}
+
+// TestEventsHandler verifies timer and switch changes are streamed until shutdown
+func TestEventsHandler(t *testing.T) {
+	defer func(d time.Duration) { sseKeepalive = d }(sseKeepalive)
+	sseKeepalive = 50 * time.Millisecond
+
+	clock := newFakeClock(testEpoch)
+	nt := newNamedTimer(defaultTimerName, hap.NewMemStore(), timerConfig{Clock: clock})
+	ctx, cancel := context.WithCancel(context.Background())
+	server := httptest.NewServer(eventsHandler(ctx, nt))
+	defer server.Close()
+
+	res, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %s, expected text/event-stream", ct)
+	}
+	events := readEvents(t, res)
+
+	if typ, out := nextEvent(t, events); typ != eventStatus || out.State != StateIdle {
+		t.Errorf("First event = %s %s, expected %s idle", typ, out.State, eventStatus)
+	}
+
+	nt.Timer.Reset(time.Minute)
+	if typ, out := nextEvent(t, events); typ != string(StateArmed) || out.Seconds != 60 || out.End == nil {
+		t.Errorf("Event after Reset = %s %+v, expected armed with 60 seconds", typ, out)
+	}
+
+	clock.Advance(time.Minute)
+	if typ, _ := nextEvent(t, events); typ != string(StateFired) {
+		t.Errorf("Event after expiry = %s, expected fired", typ)
+	}
+	nt.switchOn("timer")
+	if typ, out := nextEvent(t, events); typ != eventSwitch || !out.Latched {
+		t.Errorf("Event after switching on = %s latched %v, expected %s latched", typ, out.Latched, eventSwitch)
+	}
+
+	select {
+	case e := <-events:
+		if e[0] != "keepalive" {
+			t.Errorf("Idle stream sent %s, expected keepalive", e[0])
+		}
+	case <-time.After(time.Second):
+		t.Error("No keepalive on idle stream")
+	}
+
+	cancel()
+	deadline := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		case <-deadline:
+			t.Fatal("Event stream not closed after shutdown")
+		}
+	}
+}
+
+// TestEventsHandlerMethod verifies only GET is supported
+func TestEventsHandlerMethod(t *testing.T) {
+	nt := newNamedTimer(defaultTimerName, hap.NewMemStore(), timerConfig{})
+	rec := httptest.NewRecorder()
+	eventsHandler(context.Background(), nt)(rec, httptest.NewRequest(http.MethodPost, "/timer/events", nil))
+	if rec.Code != http.StatusNotImplemented {
+		t.Errorf("POST returned status %d, expected %d", rec.Code, http.StatusNotImplemented)
+	}
+}
+
+// TestEventClockStep verifies a wall-clock step alone publishes no event,
+// while the persisted end time still follows it
+func TestEventClockStep(t *testing.T) {
+	clock := newFakeClock(testEpoch)
+	events := newEventHub()
+	store := hap.NewMemStore()
+	nt := newNamedTimer(defaultTimerName, store, timerConfig{Clock: clock, Events: events})
+	nt.persister.Track(nt.Timer)
+	c, unsubscribe := events.Subscribe(nt.Name, 16)
+	defer unsubscribe()
+
+	nt.Timer.Reset(time.Hour)
+	if e := <-c; e.Type != string(StateArmed) {
+		t.Fatalf("Event after Reset = %s, expected %s", e.Type, StateArmed)
+	}
+
+	clock.Step(24 * time.Hour)
+	nt.Timer.Resync()
+	select {
+	case e := <-c:
+		t.Errorf("Clock step published %s event from %s", e.Type, e.Source)
+	default:
+	}
+	if pt, _, _ := nt.persister.Load(); !pt.End.Equal(nt.Timer.End()) {
+		t.Errorf("Persisted end = %v, expected %v after the step", pt.End, nt.Timer.End())
+	}
+}
+
+// TestEventSource verifies events name what changed the timer
+func TestEventSource(t *testing.T) {
+	clock := newFakeClock(testEpoch)
+	events := newEventHub()
+	nt := newNamedTimer(defaultTimerName, hap.NewMemStore(), timerConfig{
+		Clock:     clock,
+		Events:    events,
+		SwitchOff: switchOffCancel,
+	})
+	c, unsubscribe := events.Subscribe(nt.Name, 16)
+	defer unsubscribe()
+
+	next := func(typ string) string {
+		t.Helper()
+		for e := range c {
+			if e.Type == typ {
+				return e.Source
+			}
+		}
+		t.Fatalf("No %s event", typ)
+		return ""
+	}
+
+	rec := httptest.NewRecorder()
+	timerHandler(nt)(rec, httptest.NewRequest(http.MethodPut, "/timer", strings.NewReader(`{"seconds": 60}`)))
+	if source := next(string(StateArmed)); source != sourceAPI {
+		t.Errorf("Source of PUT = %q, expected %q", source, sourceAPI)
+	}
+
+	clock.Advance(time.Minute)
+	if source := next(string(StateFired)); source != sourceTimer {
+		t.Errorf("Source of expiry = %q, expected %q", source, sourceTimer)
+	}
+
+	nt.Timer.Reset(time.Minute)
+	nt.On.SetValue(true)
+	nt.On.SetValueRequest(false, httptest.NewRequest(http.MethodPut, "/characteristics", nil))
+	if source := next(string(StateCancelled)); source != sourceHomeKit {
+		t.Errorf("Source of switching off = %q, expected %q", source, sourceHomeKit)
+	}
+
+	for len(c) > 0 {
+		<-c
+	}
+	nt.Schedules.fire()
+	if source := next(eventSwitch); source != sourceSchedule {
+		t.Errorf("Source of schedule = %q, expected %q", source, sourceSchedule)
+	}
+}
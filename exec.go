@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Exec hook limits
+const (
+	maxExecOutput = 4096            // Bytes of command output logged, the rest is discarded
+	execWaitDelay = 5 * time.Second // How long to wait for output after the command was killed
+)
+
+// execShell runs hook commands, a variable so tests can replace it.
+var execShell = "/bin/sh"
+
+// execHook runs a shell command on timer events, like disabling guest Wi-Fi
+// on the router when a timer fires. Commands run one at a time: events
+// arriving while a command runs wait in arrival order, with at most one per
+// event type, where a newer event replaces an older one of its type. So a
+// burst of events can't spawn a process each, and a re-arm can't drop a fire.
+type execHook struct {
+	command string
+	events  map[string]bool
+	timeout time.Duration
+
+	mu      sync.Mutex   // guards pending
+	pending []*execEvent // events to run the command for, oldest first
+	wake    chan struct{}
+}
+
+// execEvent is an event waiting for the command to run.
+type execEvent struct {
+	timerEvent
+	time time.Time
+}
+
+// newExecHook validates the -exec flags. events is a comma-separated list of
+// event types, as for webhooks.
+func newExecHook(command, events string, timeout time.Duration) (*execHook, error) {
+	if timeout <= 0 {
+		return nil, fmt.Errorf("timeout must be positive")
+	}
+	h := &execHook{
+		command: command,
+		events:  make(map[string]bool),
+		timeout: timeout,
+		wake:    make(chan struct{}, 1),
+	}
+	for _, e := range strings.Split(events, ",") {
+		e = strings.TrimSpace(e)
+		if !webhookEvents[e] {
+			return nil, fmt.Errorf("unknown event %q", e)
+		}
+		h.events[e] = true
+	}
+	return h, nil
+}
+
+// Handle queues e if the hook runs on it, without blocking. It is registered
+// with eventHub.Listen.
+func (h *execHook) Handle(e timerEvent) {
+	if !h.events[e.Type] {
+		return
+	}
+	h.mu.Lock()
+	for i, p := range h.pending {
+		if p.Type == e.Type {
+			log.Printf("Exec hook busy, skipping %s event for a newer one", p.Type)
+			h.pending = append(h.pending[:i], h.pending[i+1:]...)
+			break
+		}
+	}
+	h.pending = append(h.pending, &execEvent{timerEvent: e, time: time.Now()})
+	h.mu.Unlock()
+
+	select {
+	case h.wake <- struct{}{}:
+	default:
+		// Already woken for the pending event
+	}
+}
+
+// Run runs the command for queued events until ctx is cancelled, killing a
+// command that is still running.
+func (h *execHook) Run(ctx context.Context) {
+	for {
+		select {
+		case <-h.wake:
+		case <-ctx.Done():
+			return
+		}
+
+		for ctx.Err() == nil {
+			h.mu.Lock()
+			if len(h.pending) == 0 {
+				h.mu.Unlock()
+				break
+			}
+			e := h.pending[0]
+			h.pending = h.pending[1:]
+			h.mu.Unlock()
+			h.run(ctx, e)
+		}
+	}
+}
+
+// run runs the command for e and logs its output.
+func (h *execHook) run(ctx context.Context, e *execEvent) {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, execShell, "-c", h.command)
+	cmd.Env = append(os.Environ(), execEnv(e)...)
+	cmd.WaitDelay = execWaitDelay
+	killProcessGroup(cmd)
+	output := &limitedBuffer{max: maxExecOutput}
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	log.Printf("Running exec hook for %s event of %s", e.Type, eventTimerName(e.timerEvent))
+	start := time.Now()
+	err := cmd.Run()
+
+	scanner := bufio.NewScanner(&output.buf)
+	for scanner.Scan() {
+		log.Printf("Exec hook: %s", scanner.Text())
+	}
+	if output.truncated {
+		log.Printf("Exec hook: (output truncated after %d bytes)", maxExecOutput)
+	}
+
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		log.Printf("Exec hook killed after timeout of %s", h.timeout)
+	case err != nil:
+		log.Printf("Exec hook failed: %s", err)
+	default:
+		log.Printf("Exec hook finished in %s", time.Since(start).Round(time.Millisecond))
+	}
+}
+
+// eventTimerName names the timer of e in logs.
+func eventTimerName(e timerEvent) string {
+	if e.Timer == "" {
+		return "all timers"
+	}
+	return "timer " + e.Timer
+}
+
+// execEnv returns the environment variables describing e to the command.
+// Variables that don't apply to the event are set but empty.
+func execEnv(e *execEvent) []string {
+	env := map[string]string{
+		"HKTIMER_EVENT":      e.Type,
+		"HKTIMER_TIMER":      e.Timer,
+		"HKTIMER_SOURCE":     e.Source,
+		"HKTIMER_TIME":       e.time.Format(time.RFC3339),
+		"HKTIMER_STATE":      "",
+		"HKTIMER_SECONDS":    "",
+		"HKTIMER_END":        "",
+		"HKTIMER_LAST_FIRED": "",
+		"HKTIMER_PAIRING_ID": "",
+	}
+	switch data := e.Data.(type) {
+	case outputTimer:
+		env["HKTIMER_STATE"] = string(data.State)
+		env["HKTIMER_SECONDS"] = strconv.Itoa(data.Seconds)
+		if data.End != nil {
+			env["HKTIMER_END"] = *data.End
+		}
+		if data.LastFired != nil {
+			env["HKTIMER_LAST_FIRED"] = *data.LastFired
+		}
+	case outputPairing:
+		env["HKTIMER_PAIRING_ID"] = data.ID
+	}
+
+	list := make([]string, 0, len(env))
+	for k, v := range env {
+		list = append(list, k+"="+v)
+	}
+	return list
+}
+
+// limitedBuffer keeps the first max bytes written to it. Writes never fail,
+// so the command isn't stopped by a full pipe. As the same buffer is used for
+// stdout and stderr, exec never writes to it concurrently.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.buf.Len(); len(p) > room {
+		b.buf.Write(p[:room])
+		b.truncated = true
+	} else {
+		b.buf.Write(p)
+	}
+	return len(p), nil
+}
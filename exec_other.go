@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "os/exec"
+
+// killProcessGroup leaves cmd alone where process groups aren't available:
+// cancelling it only kills the shell, and the output of processes it started
+// is abandoned after execWaitDelay.
+func killProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a log output safe for concurrent writes and reads
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// captureLog redirects the log to a buffer until the test ends
+func captureLog(t *testing.T) *syncBuffer {
+	t.Helper()
+	buf := &syncBuffer{}
+	out := log.Writer()
+	log.SetOutput(buf)
+	t.Cleanup(func() { log.SetOutput(out) })
+	return buf
+}
+
+// runExecHook starts h until the test ends
+func runExecHook(t *testing.T, h *execHook) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		h.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// waitFor polls cond for up to two seconds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestExecHookEnv verifies the command gets the event in its environment and its output is logged
+func TestExecHookEnv(t *testing.T) {
+	logs := captureLog(t)
+	h, err := newExecHook(`echo "$HKTIMER_EVENT $HKTIMER_TIMER $HKTIMER_SOURCE $HKTIMER_STATE $HKTIMER_LAST_FIRED"; echo oops >&2`, "fired", time.Second)
+	if err != nil {
+		t.Fatalf("newExecHook failed: %v", err)
+	}
+	runExecHook(t, h)
+
+	fired := testEpoch.Format(time.RFC3339)
+	h.Handle(timerEvent{Type: string(StateArmed), Timer: "kids"})
+	h.Handle(timerEvent{Type: string(StateFired), Timer: "kids", Source: sourceTimer, Data: outputTimer{State: StateFired, LastFired: &fired}})
+
+	waitFor(t, "the hook to finish", func() bool { return strings.Contains(logs.String(), "Exec hook finished") })
+	out := logs.String()
+	if !strings.Contains(out, "Exec hook: fired kids timer fired "+fired) {
+		t.Errorf("Log doesn't show the environment:\n%s", out)
+	}
+	if !strings.Contains(out, "Exec hook: oops") {
+		t.Errorf("Log doesn't show stderr:\n%s", out)
+	}
+	if strings.Contains(out, "armed event") {
+		t.Errorf("Hook ran for an armed event:\n%s", out)
+	}
+}
+
+// TestExecHookTimeout verifies commands running too long are killed
+func TestExecHookTimeout(t *testing.T) {
+	logs := captureLog(t)
+	h, _ := newExecHook("sleep 10", "fired", 50*time.Millisecond)
+	runExecHook(t, h)
+
+	start := time.Now()
+	h.Handle(timerEvent{Type: string(StateFired)})
+	waitFor(t, "the hook to be killed", func() bool { return strings.Contains(logs.String(), "killed after timeout") })
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Hook killed after %s, expected about 50ms", elapsed)
+	}
+}
+
+// TestExecHookStorm verifies a burst of events runs the command at most twice
+func TestExecHookStorm(t *testing.T) {
+	dir := t.TempDir()
+	release := filepath.Join(dir, "release")
+	runs := filepath.Join(dir, "runs")
+
+	// Each run records itself, then waits until the test lets it finish
+	h, _ := newExecHook(`echo "$HKTIMER_SECONDS" >> `+runs+`; while [ ! -e `+release+` ]; do sleep 0.01; done`, "armed", 5*time.Second)
+	runExecHook(t, h)
+
+	count := func() []string {
+		b, _ := os.ReadFile(runs)
+		return strings.Fields(string(b))
+	}
+	h.Handle(timerEvent{Type: string(StateArmed), Data: outputTimer{Seconds: 0}})
+	waitFor(t, "the first run", func() bool { return len(count()) == 1 })
+
+	for i := 1; i <= 50; i++ {
+		h.Handle(timerEvent{Type: string(StateArmed), Data: outputTimer{Seconds: i}})
+	}
+	os.WriteFile(release, nil, 0o600)
+
+	// Only the newest event of the burst runs
+	waitFor(t, "the second run", func() bool { return len(count()) == 2 })
+	time.Sleep(50 * time.Millisecond)
+	if got := count(); len(got) != 2 || got[1] != "50" {
+		t.Errorf("Runs = %v, expected [0 50]", got)
+	}
+}
+
+// TestExecHookKeepsFire verifies an event of another type doesn't replace a pending fire
+func TestExecHookKeepsFire(t *testing.T) {
+	dir := t.TempDir()
+	release := filepath.Join(dir, "release")
+	runs := filepath.Join(dir, "runs")
+
+	h, _ := newExecHook(`echo "$HKTIMER_EVENT$HKTIMER_SECONDS" >> `+runs+`; while [ ! -e `+release+` ]; do sleep 0.01; done`, "fired,armed", 5*time.Second)
+	runExecHook(t, h)
+
+	count := func() []string {
+		b, _ := os.ReadFile(runs)
+		return strings.Fields(string(b))
+	}
+	h.Handle(timerEvent{Type: string(StateArmed), Data: outputTimer{Seconds: 1}})
+	waitFor(t, "the first run", func() bool { return len(count()) == 1 })
+
+	// Fired, then re-armed twice while the hook is busy
+	h.Handle(timerEvent{Type: string(StateFired), Data: outputTimer{Seconds: 0}})
+	h.Handle(timerEvent{Type: string(StateArmed), Data: outputTimer{Seconds: 2}})
+	h.Handle(timerEvent{Type: string(StateArmed), Data: outputTimer{Seconds: 3}})
+	os.WriteFile(release, nil, 0o600)
+
+	waitFor(t, "the queued runs", func() bool { return len(count()) == 3 })
+	time.Sleep(50 * time.Millisecond)
+	if got := strings.Join(count(), " "); got != "armed1 fired0 armed3" {
+		t.Errorf("Runs = %s, expected armed1 fired0 armed3", got)
+	}
+}
+
+// TestNewExecHookInvalid verifies invalid events and timeouts are rejected
+func TestNewExecHookInvalid(t *testing.T) {
+	if _, err := newExecHook("true", "fired,exploded", time.Second); err == nil {
+		t.Error("newExecHook accepted an unknown event")
+	}
+	if _, err := newExecHook("true", "fired", 0); err == nil {
+		t.Error("newExecHook accepted a zero timeout")
+	}
+	h, err := newExecHook("true", "fired, cancelled", time.Second)
+	if err != nil || !h.events[string(StateCancelled)] {
+		t.Errorf("newExecHook with spaces = %v, %v", h, err)
+	}
+}
+
+// TestLimitedBuffer verifies output beyond the limit is discarded
+func TestLimitedBuffer(t *testing.T) {
+	b := &limitedBuffer{max: 5}
+	b.Write([]byte("abc"))
+	if n, err := b.Write([]byte("defg")); n != 4 || err != nil {
+		t.Errorf("Write = %d, %v, expected the full length without error", n, err)
+	}
+	if b.buf.String() != "abcde" || !b.truncated {
+		t.Errorf("Buffer = %q, truncated %v, expected \"abcde\" truncated", b.buf.String(), b.truncated)
+	}
+}
@@ -2,7 +2,10 @@ module hktimer
 
 go 1.24.0
 
-require github.com/brutella/hap v0.0.35
+require (
+	github.com/brutella/hap v0.0.35
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+)
 
 require (
 	github.com/brutella/dnssd v1.2.14 // indirect
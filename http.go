@@ -1,11 +1,17 @@
 package main
 
 import (
+	"github.com/brutella/hap"
+
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -14,36 +20,186 @@ const (
 	minTimerSeconds     = 0          // Minimum timer value (0 = fire immediately)
 	maxTimerSeconds     = 86400 * 30 // Maximum timer value: 30 days in seconds
 	maxRequestBodyBytes = 1024       // Maximum request body size to prevent DoS attacks
+	upcomingFires       = 5          // Number of upcoming schedule fire times reported
+	maxWaitSeconds      = 3600       // Maximum long-poll wait of GET ?wait=
 )
 
+// Actions on a running timer, served below the timer path (e.g. /timer/pause)
+const (
+	actionPause  = "pause"  // Suspend the countdown, keeping the remaining time
+	actionResume = "resume" // Continue a paused countdown
+	actionAdd    = "add"    // Add (or subtract) seconds relative to the current end
+)
+
+// inputSchedule represents the JSON payload for adding a schedule via POST request.
+type inputSchedule struct {
+	Cron string `json:"cron"` // Cron expression, e.g. "30 7 * * MON-FRI" or "@daily"
+}
+
+// outputSchedule represents one schedule in the JSON response for GET requests.
+type outputSchedule struct {
+	ID        string   `json:"id"`         // Identifier used to delete the schedule
+	Cron      string   `json:"cron"`       // Cron expression as given
+	NextFires []string `json:"next_fires"` // ISO8601 timestamps of the next fires
+}
+
 // inputTimer represents the JSON payload for setting a timer via PUT request.
 type inputTimer struct {
-	Seconds int `json:"seconds"` // Number of seconds until timer fires
+	Seconds *timerSeconds `json:"seconds,omitempty"` // Seconds until timer fires, or a duration like "1h30m" or "PT90M"; nil if not given
+	At      string        `json:"at,omitempty"`      // RFC3339 time or local HH:MM when timer fires, instead of seconds
+}
+
+// seconds returns the requested seconds, or 0 if none were given.
+func (in inputTimer) seconds() int {
+	if in.Seconds == nil {
+		return 0
+	}
+	return int(*in.Seconds)
 }
 
 // outputTimer represents the JSON response for GET requests showing timer status.
 type outputTimer struct {
-	Seconds int    `json:"seconds"` // Seconds remaining until timer fires
-	End     string `json:"end"`     // ISO8601 timestamp when timer will fire
+	State       TimerState `json:"state"`        // Timer state (idle, armed, paused, fired, cancelled)
+	Seconds     int        `json:"seconds"`      // Seconds remaining until timer fires
+	Remaining   string     `json:"remaining"`    // Seconds remaining as a duration like 1h30m
+	End         *string    `json:"end"`          // ISO8601 timestamp when timer will fire, null unless armed
+	LastFired   *string    `json:"last_fired"`   // ISO8601 timestamp of the last fire, null if never fired
+	Latched     bool       `json:"latched"`      // Whether the HomeKit switch is currently on
+	NextFires   []string   `json:"next_fires"`   // ISO8601 timestamps of the next scheduled fires
+	ClockSynced bool       `json:"clock_synced"` // Whether the wall clock is trusted; end times may move until it is
+}
+
+// newOutputTimer builds the JSON response for a status snapshot of nt.
+func newOutputTimer(nt *namedTimer, status TimerStatus) outputTimer {
+	seconds := int(math.Round(status.Remaining().Seconds()))
+	return outputTimer{
+		State:       status.State,
+		Seconds:     seconds,
+		Remaining:   formatSeconds(seconds),
+		End:         formatTime(status.End),
+		LastFired:   formatTime(status.LastFired),
+		Latched:     nt.Latched(),
+		NextFires:   formatTimes(nt.Schedules.Next(nt.Timer.Now(), upcomingFires)),
+		ClockSynced: nt.config.Sync.Synced(),
+	}
+}
+
+// outputWait represents the JSON response for GET requests with ?wait=.
+type outputWait struct {
+	outputTimer
+	Event string `json:"event"` // What ended the wait: the new state, or "timeout"
+}
+
+// outputNamedTimer represents one timer in the JSON response for GET /timers.
+type outputNamedTimer struct {
+	Name string `json:"name"` // Timer name, as used in /timers/{name}
+	outputTimer
+}
+
+// formatTime formats t as ISO8601, or returns nil for the zero time.
+func formatTime(t time.Time) *string {
+	if t.IsZero() {
+		return nil
+	}
+	s := t.Format(time.RFC3339)
+	return &s
+}
+
+// formatTimes formats times as ISO8601, returning an empty list rather than nil.
+func formatTimes(times []time.Time) []string {
+	list := make([]string, len(times))
+	for i, t := range times {
+		list[i] = t.Format(time.RFC3339)
+	}
+	return list
+}
+
+// parseDeadline parses an absolute time given as RFC3339, or as local HH:MM in
+// loc (time.Local if nil). HH:MM refers to its next occurrence after now, so
+// a time earlier than now means tomorrow.
+func parseDeadline(s string, now time.Time, loc *time.Location) (time.Time, error) {
+	if end, err := time.Parse(time.RFC3339, s); err == nil {
+		return end, nil
+	}
+
+	clock, err := time.Parse("15:04", s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parse time %q: not RFC3339 or HH:MM", s)
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+	now = now.In(loc)
+	end := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, loc)
+	if !end.After(now) {
+		// Add a calendar day rather than 24 hours so DST changes keep the wall-clock time
+		end = time.Date(now.Year(), now.Month(), now.Day()+1, clock.Hour(), clock.Minute(), 0, 0, loc)
+	}
+	return end, nil
+}
+
+// registerTimerSetRoutes registers the handlers for every timer in ts below
+// /timers/{name}, the listing at /timers, and /timer for the first timer.
+// Event streams end when ctx is cancelled.
+func registerTimerSetRoutes(ctx context.Context, mux hap.ServeMux, ts *timerSet) {
+	mux.HandleFunc("/timers", timersHandler(ts))
+	for _, nt := range ts.All() {
+		registerTimerRoutes(ctx, mux, "/timers/"+nt.Name, nt)
+	}
+	registerTimerRoutes(ctx, mux, "/timer", ts.All()[0])
+}
+
+// registerTimerRoutes registers the handlers for timer nt below path:
+//   - path: GET, PUT and DELETE, see timerHandler
+//   - path/pause, path/resume, path/add: POST, see timerActionHandler
+//   - path/schedules and path/schedules/{id}: see schedulesHandler
+//   - path/events: GET, see eventsHandler
+func registerTimerRoutes(ctx context.Context, mux hap.ServeMux, path string, nt *namedTimer) {
+	mux.HandleFunc(path, timerHandler(nt))
+	for _, action := range []string{actionPause, actionResume, actionAdd} {
+		mux.HandleFunc(path+"/"+action, timerActionHandler(nt, action))
+	}
+	schedules := schedulesHandler(nt, path+"/schedules")
+	mux.HandleFunc(path+"/schedules", schedules)
+	mux.HandleFunc(path+"/schedules/*", schedules)
+	mux.HandleFunc(path+"/events", eventsHandler(ctx, nt))
 }
 
 // timerHandler creates an HTTP handler for managing the timer.
 // It supports:
-//   - GET: Returns current timer status (seconds remaining and end time)
-//   - PUT: Sets a new timer duration (0 to 30 days)
+//   - GET: Returns current timer status (seconds remaining and end time);
+//     with ?wait=<seconds>, once the state changes or the wait expires
+//   - PUT: Sets a new timer duration (0 to 30 days), or an absolute time
+//     within the next 30 days
+//   - DELETE: Cancels the countdown without firing
 //
 // The handler is thread-safe and can handle concurrent requests.
-func timerHandler(t *SecondsTimer) http.HandlerFunc {
+func timerHandler(nt *namedTimer) http.HandlerFunc {
+	t := nt.Timer
 	return func(res http.ResponseWriter, req *http.Request) {
 		switch req.Method {
 		// GET: Return current timer status
 		case http.MethodGet:
 			log.Printf("GET request from %s", req.Header.Get("User-Agent"))
 
-			// Build response with current timer state
-			output := outputTimer{
-				Seconds: int(math.Round(t.TimeRemaining().Seconds())),
-				End:     t.End().Format(time.RFC3339),
+			// Build response from a consistent snapshot of the timer, or
+			// after waiting for a change
+			var output interface{}
+			if wait := req.URL.Query().Get("wait"); wait != "" {
+				seconds, err := strconv.Atoi(wait)
+				if err != nil || seconds < 1 || seconds > maxWaitSeconds {
+					log.Printf("GET request failed: invalid wait %q", wait)
+					http.Error(res, fmt.Sprintf("Wait must be between 1 and %d seconds", maxWaitSeconds), http.StatusBadRequest)
+					return
+				}
+				event, status, ok := nt.Wait(req.Context(), time.Duration(seconds)*time.Second)
+				if !ok {
+					// Client went away or hktimer is stopping
+					return
+				}
+				output = outputWait{outputTimer: newOutputTimer(nt, status), Event: event}
+			} else {
+				output = newOutputTimer(nt, t.Status())
 			}
 			jsonData, err := json.Marshal(output)
 			if err != nil {
@@ -68,6 +224,11 @@ func timerHandler(t *SecondsTimer) http.HandlerFunc {
 			decoder := json.NewDecoder(req.Body)
 			decoder.DisallowUnknownFields() // Reject unknown fields for strict validation
 			err := decoder.Decode(&jsonData)
+			if errors.Is(err, errInvalidDuration) {
+				log.Printf("PUT request failed: %s", err)
+				http.Error(res, invalidDurationMessage, http.StatusBadRequest)
+				return
+			}
 			if err != nil {
 				// Log detailed error but return generic message to client for security
 				log.Printf("PUT request decode error: %s", err)
@@ -75,26 +236,82 @@ func timerHandler(t *SecondsTimer) http.HandlerFunc {
 				return
 			}
 
+			// Absolute time: fire at a wall-clock time instead of after a duration
+			if jsonData.At != "" {
+				if jsonData.Seconds != nil {
+					log.Printf("PUT request failed: both seconds and at given")
+					http.Error(res, "Specify either seconds or at", http.StatusBadRequest)
+					return
+				}
+				if !nt.config.Sync.Synced() {
+					// Relative to a wall clock that is still in 1970, any time would be wrong
+					log.Printf("PUT request failed: clock not synced")
+					http.Error(res, "Clock not synced yet, use seconds", http.StatusServiceUnavailable)
+					return
+				}
+				end, err := parseDeadline(jsonData.At, t.Now(), nt.config.Location)
+				if err != nil {
+					log.Printf("PUT request failed: %s", err)
+					http.Error(res, "Invalid time, use RFC3339 or HH:MM", http.StatusBadRequest)
+					return
+				}
+
+				// Validate the deadline against the same window as durations
+				remaining := end.Sub(t.Now())
+				if remaining < minTimerSeconds*time.Second {
+					log.Printf("PUT request failed: time in the past (%s)", jsonData.At)
+					http.Error(res, "Time must be in the future", http.StatusBadRequest)
+					return
+				}
+				if remaining > maxTimerSeconds*time.Second {
+					log.Printf("PUT request failed: time too far ahead (%s)", jsonData.At)
+					http.Error(res, fmt.Sprintf("Time exceeds maximum duration (%d seconds)", maxTimerSeconds), http.StatusBadRequest)
+					return
+				}
+
+				t.Via(sourceAPI).ResetAt(end)
+				log.Printf("Set timer to %s", end.Format(time.RFC3339))
+
+				res.Header().Set("Content-Type", "application/json")
+				res.Write([]byte(`{"success":true}`))
+				return
+			}
+
 			// Validate timer bounds
-			if jsonData.Seconds < minTimerSeconds {
-				log.Printf("PUT request failed: timer value too small (%d)", jsonData.Seconds)
+			seconds := jsonData.seconds()
+			if seconds < minTimerSeconds {
+				log.Printf("PUT request failed: timer value too small (%d)", seconds)
 				http.Error(res, "Timer must be positive", http.StatusBadRequest)
 				return
 			}
-			if jsonData.Seconds > maxTimerSeconds {
-				log.Printf("PUT request failed: timer value too large (%d)", jsonData.Seconds)
-				http.Error(res, fmt.Sprintf("Timer exceeds maximum duration (%d seconds)", maxTimerSeconds), http.StatusBadRequest)
+			if seconds > maxTimerSeconds {
+				log.Printf("PUT request failed: timer value too large (%d)", seconds)
+				http.Error(res, fmt.Sprintf("Timer exceeds maximum duration (%d seconds, %s)", maxTimerSeconds, formatSeconds(maxTimerSeconds)), http.StatusBadRequest)
 				return
 			}
 
 			// All validation passed - set the timer
-			t.Reset(time.Duration(jsonData.Seconds) * time.Second)
-			log.Printf("Set timer to %d seconds", jsonData.Seconds)
+			t.Via(sourceAPI).Reset(time.Duration(seconds) * time.Second)
+			log.Printf("Set timer to %d seconds", seconds)
 
 			// Return success response
 			res.Header().Set("Content-Type", "application/json")
 			res.Write([]byte(`{"success":true}`))
 
+		// DELETE: Cancel the countdown
+		case http.MethodDelete:
+			log.Printf("DELETE request from %s", req.Header.Get("User-Agent"))
+
+			if !t.Via(sourceAPI).Stop() {
+				log.Printf("DELETE request failed: timer not running")
+				http.Error(res, "Timer is not running", http.StatusConflict)
+				return
+			}
+			log.Printf("Cancelled timer")
+
+			res.Header().Set("Content-Type", "application/json")
+			res.Write([]byte(`{"success":true}`))
+
 		default:
 			// Reject unsupported HTTP methods
 			log.Printf("HTTP request not supported")
@@ -102,3 +319,213 @@ func timerHandler(t *SecondsTimer) http.HandlerFunc {
 		}
 	}
 }
+
+// timerActionHandler creates an HTTP handler performing action on the timer.
+// Actions only accept POST:
+//   - pause: Suspends the countdown, keeping the remaining time
+//   - resume: Continues a paused countdown
+//   - add: Adds {"seconds": n} to the remaining time; n may be negative.
+//     The new remaining time must stay within 0 to 30 days.
+//
+// Actions on a timer that is not in the required state fail with 409 Conflict.
+func timerActionHandler(nt *namedTimer, action string) http.HandlerFunc {
+	t := nt.Timer
+	return func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			log.Printf("HTTP request not supported")
+			http.Error(res, "Not supported", http.StatusNotImplemented)
+			return
+		}
+		log.Printf("POST %s request from %s", action, req.Header.Get("User-Agent"))
+
+		// Limit request body size to prevent DoS attacks
+		req.Body = http.MaxBytesReader(res, req.Body, maxRequestBodyBytes)
+
+		var err error
+		switch action {
+		case actionPause:
+			err = t.Via(sourceAPI).Pause()
+		case actionResume:
+			err = t.Via(sourceAPI).Resume()
+		case actionAdd:
+			var jsonData inputTimer
+			decoder := json.NewDecoder(req.Body)
+			decoder.DisallowUnknownFields() // Reject unknown fields for strict validation
+			if err := decoder.Decode(&jsonData); errors.Is(err, errInvalidDuration) {
+				log.Printf("POST %s request failed: %s", action, err)
+				http.Error(res, invalidDurationMessage, http.StatusBadRequest)
+				return
+			} else if err != nil {
+				log.Printf("POST %s request decode error: %s", action, err)
+				http.Error(res, "Invalid request format", http.StatusBadRequest)
+				return
+			}
+			if jsonData.Seconds == nil || jsonData.At != "" {
+				// Adding to an absolute time makes no sense, and nothing to add is likely a typo
+				log.Printf("POST %s request failed: seconds missing or at given", action)
+				http.Error(res, "Specify the seconds to add", http.StatusBadRequest)
+				return
+			}
+			// Check the range before converting, so huge values can't wrap around
+			seconds := jsonData.seconds()
+			if seconds < -maxTimerSeconds || seconds > maxTimerSeconds {
+				err = ErrOutOfRange
+				break
+			}
+			var remaining time.Duration
+			remaining, err = t.Via(sourceAPI).Adjust(time.Duration(seconds)*time.Second, maxTimerSeconds*time.Second)
+			if err == nil {
+				log.Printf("Added %d seconds, %d seconds remaining", seconds, int(remaining.Seconds()))
+			}
+		}
+
+		switch {
+		case errors.Is(err, ErrOutOfRange):
+			log.Printf("POST %s request failed: %s", action, err)
+			http.Error(res, fmt.Sprintf("Timer must be between %d and %d seconds (%s)", minTimerSeconds, maxTimerSeconds, formatSeconds(maxTimerSeconds)), http.StatusBadRequest)
+			return
+		case err != nil:
+			log.Printf("POST %s request failed: %s", action, err)
+			http.Error(res, "Timer is not "+requiredState(action), http.StatusConflict)
+			return
+		}
+
+		res.Header().Set("Content-Type", "application/json")
+		res.Write([]byte(`{"success":true}`))
+	}
+}
+
+// requiredState describes the timer state an action needs, for error messages.
+func requiredState(action string) string {
+	switch action {
+	case actionPause:
+		return "armed"
+	case actionResume:
+		return "paused"
+	default:
+		return "running"
+	}
+}
+
+// timersHandler creates an HTTP handler listing all timers.
+// It only supports GET, returning the status of every timer in configured order.
+func timersHandler(ts *timerSet) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			log.Printf("HTTP request not supported")
+			http.Error(res, "Not supported", http.StatusNotImplemented)
+			return
+		}
+		log.Printf("GET timers request from %s", req.Header.Get("User-Agent"))
+
+		output := []outputNamedTimer{}
+		for _, nt := range ts.All() {
+			output = append(output, outputNamedTimer{
+				Name:        nt.Name,
+				outputTimer: newOutputTimer(nt, nt.Timer.Status()),
+			})
+		}
+		jsonData, err := json.Marshal(output)
+		if err != nil {
+			log.Printf("GET timers request failed with: %s", err)
+			http.Error(res, "Unable to output timers", http.StatusInternalServerError)
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		res.Write(jsonData)
+	}
+}
+
+// schedulesHandler creates an HTTP handler for managing the recurring
+// schedules of a timer, served at path and path/{id}.
+// It supports:
+//   - GET path: Lists the schedules with their next fire times
+//   - POST path: Adds a schedule from {"cron": "..."}, returning its id
+//   - DELETE path/{id}: Removes a schedule
+func schedulesHandler(nt *namedTimer, path string) http.HandlerFunc {
+	s := nt.Schedules
+	return func(res http.ResponseWriter, req *http.Request) {
+		id := strings.TrimPrefix(strings.TrimPrefix(req.URL.Path, path), "/")
+
+		switch {
+		case req.Method == http.MethodGet && id == "":
+			log.Printf("GET schedules request from %s", req.Header.Get("User-Agent"))
+
+			now := nt.Timer.Now()
+			output := []outputSchedule{}
+			for _, sc := range s.List() {
+				output = append(output, outputSchedule{
+					ID:        sc.ID,
+					Cron:      sc.Cron,
+					NextFires: formatTimes(s.Upcoming(sc, now, upcomingFires)),
+				})
+			}
+			jsonData, err := json.Marshal(output)
+			if err != nil {
+				log.Printf("GET schedules request failed with: %s", err)
+				http.Error(res, "Unable to output schedules", http.StatusInternalServerError)
+				return
+			}
+			res.Header().Set("Content-Type", "application/json")
+			res.Write(jsonData)
+
+		case req.Method == http.MethodPost && id == "":
+			log.Printf("POST schedules request from %s", req.Header.Get("User-Agent"))
+
+			// Limit request body size to prevent DoS attacks
+			req.Body = http.MaxBytesReader(res, req.Body, maxRequestBodyBytes)
+
+			var jsonData inputSchedule
+			decoder := json.NewDecoder(req.Body)
+			decoder.DisallowUnknownFields() // Reject unknown fields for strict validation
+			if err := decoder.Decode(&jsonData); err != nil {
+				log.Printf("POST schedules request decode error: %s", err)
+				http.Error(res, "Invalid request format", http.StatusBadRequest)
+				return
+			}
+
+			sc, err := s.Add(jsonData.Cron)
+			switch {
+			case errors.Is(err, ErrTooManySchedules):
+				log.Printf("POST schedules request failed: %s", err)
+				http.Error(res, fmt.Sprintf("Too many schedules (at most %d)", maxSchedules), http.StatusConflict)
+				return
+			case errors.Is(err, errInvalidCron):
+				log.Printf("POST schedules request failed: %s", err)
+				http.Error(res, "Invalid cron expression", http.StatusBadRequest)
+				return
+			case err != nil:
+				log.Printf("POST schedules request failed: %s", err)
+				http.Error(res, "Unable to save schedule", http.StatusInternalServerError)
+				return
+			}
+			log.Printf("Added schedule %s (%s) to timer %s", sc.ID, sc.Cron, nt.Name)
+
+			res.Header().Set("Content-Type", "application/json")
+			res.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(res, `{"success":true,"id":%q}`, sc.ID)
+
+		case req.Method == http.MethodDelete && id != "":
+			log.Printf("DELETE schedule %s request from %s", id, req.Header.Get("User-Agent"))
+
+			ok, err := s.Remove(id)
+			if err != nil {
+				log.Printf("DELETE schedule request failed: %s", err)
+				http.Error(res, "Unable to save schedules", http.StatusInternalServerError)
+				return
+			}
+			if !ok {
+				http.Error(res, "Schedule not found", http.StatusNotFound)
+				return
+			}
+			log.Printf("Removed schedule %s from timer %s", id, nt.Name)
+
+			res.Header().Set("Content-Type", "application/json")
+			res.Write([]byte(`{"success":true}`))
+
+		default:
+			log.Printf("HTTP request not supported")
+			http.Error(res, "Not supported", http.StatusNotImplemented)
+		}
+	}
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"github.com/brutella/hap"
+
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -10,12 +13,19 @@ import (
 	"time"
 )
 
+// namedTimerFor wraps timer in a named timer for the handlers, sharing its clock
+func namedTimerFor(timer *SecondsTimer) *namedTimer {
+	nt := newNamedTimer(defaultTimerName, hap.NewMemStore(), timerConfig{Clock: timer.clock})
+	nt.Timer = timer
+	return nt
+}
+
 // TestTimerHandlerGET tests GET requests to /timer
 func TestTimerHandlerGET(t *testing.T) {
 	timer := NewSecondsTimer(10 * time.Second)
 	defer timer.Stop()
 
-	handler := timerHandler(timer)
+	handler := timerHandler(namedTimerFor(timer))
 	req := httptest.NewRequest(http.MethodGet, "/timer", nil)
 	rec := httptest.NewRecorder()
 
@@ -43,22 +53,135 @@ func TestTimerHandlerGET(t *testing.T) {
 		t.Errorf("Response seconds = %d, expected ~10", response.Seconds)
 	}
 
-	if response.End == "" {
-		t.Error("Response end time is empty")
+	if response.State != StateArmed {
+		t.Errorf("Response state = %s, expected %s", response.State, StateArmed)
+	}
+
+	if response.End == nil {
+		t.Fatal("Response end time is null")
 	}
 
 	// Verify end time is valid RFC3339
-	if _, err := time.Parse(time.RFC3339, response.End); err != nil {
+	if _, err := time.Parse(time.RFC3339, *response.End); err != nil {
 		t.Errorf("End time not valid RFC3339: %v", err)
 	}
+
+	if response.LastFired != nil {
+		t.Errorf("Response last_fired = %s, expected null", *response.LastFired)
+	}
+
+	if response.Latched {
+		t.Error("Response latched = true, expected false")
+	}
+
+	if !response.ClockSynced {
+		t.Error("Response clock_synced = false, expected true")
+	}
+}
+
+// TestTimerHandlerGETLatched tests that GET reports a switch left on
+func TestTimerHandlerGETLatched(t *testing.T) {
+	nt := namedTimerFor(NewIdleTimer())
+	nt.switchOn("timer")
+
+	req := httptest.NewRequest(http.MethodGet, "/timer", nil)
+	rec := httptest.NewRecorder()
+	timerHandler(nt)(rec, req)
+
+	var response outputTimer
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+	if !response.Latched {
+		t.Error("Response latched = false, expected true")
+	}
+}
+
+// TestTimerHandlerGETRounding tests that GET rounds the remaining time to whole seconds
+func TestTimerHandlerGETRounding(t *testing.T) {
+	timer, clock := newFakeTimer(10 * time.Second)
+	handler := timerHandler(namedTimerFor(timer))
+
+	testCases := []struct {
+		elapsed time.Duration
+		seconds int
+	}{
+		{0, 10},
+		{400 * time.Millisecond, 10},
+		{1500 * time.Millisecond, 9},
+		{9600 * time.Millisecond, 0},
+	}
+
+	var elapsed time.Duration
+	for _, tc := range testCases {
+		clock.Advance(tc.elapsed - elapsed)
+		elapsed = tc.elapsed
+
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/timer", nil))
+
+		var response outputTimer
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to parse JSON response: %v", err)
+		}
+		if response.Seconds != tc.seconds {
+			t.Errorf("After %v, seconds = %d, expected %d", tc.elapsed, response.Seconds, tc.seconds)
+		}
+		if remaining := formatSeconds(tc.seconds); response.Remaining != remaining {
+			t.Errorf("After %v, remaining = %q, expected %q", tc.elapsed, response.Remaining, remaining)
+		}
+	}
+}
+
+// TestTimerHandlerGETNotArmed tests that end is null when nothing is armed
+func TestTimerHandlerGETNotArmed(t *testing.T) {
+	testCases := []struct {
+		name      string
+		setup     func(*SecondsTimer)
+		state     TimerState
+		lastFired bool
+	}{
+		{"Idle", func(*SecondsTimer) {}, StateIdle, false},
+		{"Cancelled", func(st *SecondsTimer) { st.Reset(time.Hour); st.Stop() }, StateCancelled, false},
+		{"Fired", func(st *SecondsTimer) { st.Reset(0); st.clock.(*fakeClock).Advance(0); <-st.C() }, StateFired, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			timer := NewIdleTimerWithClock(newFakeClock(testEpoch))
+			tc.setup(timer)
+
+			handler := timerHandler(namedTimerFor(timer))
+			req := httptest.NewRequest(http.MethodGet, "/timer", nil)
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			var response outputTimer
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse JSON response: %v", err)
+			}
+
+			if response.State != tc.state {
+				t.Errorf("Response state = %s, expected %s", response.State, tc.state)
+			}
+			if response.Seconds != 0 {
+				t.Errorf("Response seconds = %d, expected 0", response.Seconds)
+			}
+			if response.End != nil {
+				t.Errorf("Response end = %s, expected null", *response.End)
+			}
+			if (response.LastFired != nil) != tc.lastFired {
+				t.Errorf("Response last_fired present = %v, expected %v", response.LastFired != nil, tc.lastFired)
+			}
+		})
+	}
 }
 
 // TestTimerHandlerPUTValid tests valid PUT requests
 func TestTimerHandlerPUTValid(t *testing.T) {
-	timer := NewSecondsTimer(time.Hour)
-	defer timer.Stop()
+	timer, _ := newFakeTimer(time.Hour)
 
-	handler := timerHandler(timer)
+	handler := timerHandler(namedTimerFor(timer))
 
 	testCases := []struct {
 		name    string
@@ -100,21 +223,66 @@ func TestTimerHandlerPUTValid(t *testing.T) {
 			// Verify timer was actually set
 			remaining := timer.TimeRemaining()
 			expectedRemaining := time.Duration(tc.seconds) * time.Second
-			diff := (remaining - expectedRemaining).Abs()
-
-			if diff > time.Second {
+			if remaining != expectedRemaining {
 				t.Errorf("Timer not set correctly: remaining=%v, expected=%v", remaining, expectedRemaining)
 			}
 		})
 	}
 }
 
+// TestTimerHandlerPUTDuration verifies durations in the formats typed in Shortcuts, and their errors
+func TestTimerHandlerPUTDuration(t *testing.T) {
+	timer, _ := newFakeTimer(time.Hour)
+	handler := timerHandler(namedTimerFor(timer))
+
+	testCases := []struct {
+		payload   string
+		status    int
+		remaining time.Duration
+		message   string
+	}{
+		{`{"seconds":"90m"}`, http.StatusOK, 90 * time.Minute, ""},
+		{`{"seconds":"PT1H30M"}`, http.StatusOK, 90 * time.Minute, ""},
+		{`{"seconds":"5400"}`, http.StatusOK, 90 * time.Minute, ""},
+		{`{"seconds":"720h"}`, http.StatusOK, 720 * time.Hour, ""},
+		{`{"seconds":"P31D"}`, http.StatusBadRequest, 0, "Timer exceeds maximum duration (2592000 seconds, 720h)"},
+		{`{"seconds":"-5m"}`, http.StatusBadRequest, 0, "Timer must be positive"},
+		{`{"seconds":"1.5s"}`, http.StatusBadRequest, 0, invalidDurationMessage},
+		{`{"seconds":"P1M"}`, http.StatusBadRequest, 0, invalidDurationMessage},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.payload, func(t *testing.T) {
+			timer.Reset(time.Hour)
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(http.MethodPut, "/timer", strings.NewReader(tc.payload)))
+
+			if rec.Code != tc.status {
+				t.Errorf("Status = %d, expected %d. Body: %s", rec.Code, tc.status, rec.Body.String())
+			}
+			if tc.message != "" && !strings.Contains(rec.Body.String(), tc.message) {
+				t.Errorf("Error message = %q, expected %q", rec.Body.String(), tc.message)
+			}
+			if tc.status == http.StatusOK && timer.TimeRemaining() != tc.remaining {
+				t.Errorf("TimeRemaining = %v, expected %v", timer.TimeRemaining(), tc.remaining)
+			}
+		})
+	}
+
+	// Relative changes accept durations too
+	timer.Reset(time.Hour)
+	rec := httptest.NewRecorder()
+	timerActionHandler(namedTimerFor(timer), actionAdd)(rec, httptest.NewRequest(http.MethodPost, "/timer/add", strings.NewReader(`{"seconds":"-15m"}`)))
+	if rec.Code != http.StatusOK || timer.TimeRemaining() != 45*time.Minute {
+		t.Errorf("Add -15m returned status %d with %v remaining, expected 45m", rec.Code, timer.TimeRemaining())
+	}
+}
+
 // TestTimerHandlerPUTInvalid tests invalid PUT requests
 func TestTimerHandlerPUTInvalid(t *testing.T) {
 	timer := NewSecondsTimer(time.Hour)
 	defer timer.Stop()
 
-	handler := timerHandler(timer)
+	handler := timerHandler(namedTimerFor(timer))
 
 	testCases := []struct {
 		name           string
@@ -144,7 +312,7 @@ func TestTimerHandlerPUTInvalid(t *testing.T) {
 			name:           "Wrong type",
 			payload:        `{"seconds":"not a number"}`,
 			expectedStatus: http.StatusBadRequest,
-			expectedError:  "Invalid request format",
+			expectedError:  "Invalid duration",
 		},
 		{
 			name:           "Unknown field",
@@ -188,12 +356,153 @@ func TestTimerHandlerPUTInvalid(t *testing.T) {
 	}
 }
 
+// TestTimerHandlerPUTAt tests setting an absolute time
+func TestTimerHandlerPUTAt(t *testing.T) {
+	timer := NewIdleTimer()
+	defer timer.Stop()
+	handler := timerHandler(namedTimerFor(timer))
+
+	// Whole seconds in a fixed offset, so the echo can be compared exactly
+	at := time.Now().Add(time.Hour).In(time.FixedZone("", 2*60*60)).Truncate(time.Second).Format(time.RFC3339)
+	req := httptest.NewRequest(http.MethodPut, "/timer", strings.NewReader(`{"at":"`+at+`"}`))
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT returned status %d, expected %d. Body: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/timer", nil))
+
+	var response outputTimer
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+	if response.End == nil || *response.End != at {
+		t.Errorf("Response end = %v, expected %s", response.End, at)
+	}
+	if response.Seconds < 3599 || response.Seconds > 3600 {
+		t.Errorf("Response seconds = %d, expected ~3600", response.Seconds)
+	}
+}
+
+// TestTimerHandlerPUTAtInvalid tests invalid absolute times
+func TestTimerHandlerPUTAtInvalid(t *testing.T) {
+	timer := NewIdleTimer()
+	handler := timerHandler(namedTimerFor(timer))
+
+	testCases := []struct {
+		name          string
+		payload       string
+		expectedError string
+	}{
+		{"Past", `{"at":"2020-01-01T00:00:00Z"}`, "Time must be in the future"},
+		{"Too far ahead", `{"at":"` + time.Now().AddDate(0, 2, 0).Format(time.RFC3339) + `"}`, "Time exceeds maximum duration"},
+		{"Not a time", `{"at":"tomorrow"}`, "Invalid time"},
+		{"Invalid clock", `{"at":"25:00"}`, "Invalid time"},
+		{"Both", `{"seconds":60,"at":"12:00"}`, "Specify either seconds or at"},
+		{"Both with zero seconds", `{"seconds":0,"at":"12:00"}`, "Specify either seconds or at"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/timer", strings.NewReader(tc.payload))
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("Status = %d, expected %d", rec.Code, http.StatusBadRequest)
+			}
+			if !strings.Contains(rec.Body.String(), tc.expectedError) {
+				t.Errorf("Error message = %q, expected to contain %q", rec.Body.String(), tc.expectedError)
+			}
+			if timer.State() != StateIdle {
+				t.Errorf("State = %s, expected %s", timer.State(), StateIdle)
+			}
+		})
+	}
+}
+
+// TestTimerHandlerClockNotSynced tests absolute times are refused until the clock is synced
+func TestTimerHandlerClockNotSynced(t *testing.T) {
+	clock := newFakeClock(time.Date(1970, 1, 1, 0, 0, 30, 0, time.UTC))
+	nt := newNamedTimer(defaultTimerName, hap.NewMemStore(), timerConfig{Clock: clock})
+	handler := timerHandler(nt)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPut, "/timer", strings.NewReader(`{"at":"06:30"}`)))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("PUT at returned status %d, expected %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	// Durations don't depend on the wall clock
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPut, "/timer", strings.NewReader(`{"seconds":60}`)))
+	if rec.Code != http.StatusOK {
+		t.Errorf("PUT seconds returned status %d, expected %d", rec.Code, http.StatusOK)
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/timer", nil))
+	var response outputTimer
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+	if response.ClockSynced || response.Seconds != 60 {
+		t.Errorf("Response clock_synced = %v, seconds = %d; expected false, 60", response.ClockSynced, response.Seconds)
+	}
+}
+
+// TestParseDeadline tests RFC3339 and HH:MM parsing
+func TestParseDeadline(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skipf("Time zone data not available: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		input    string
+		now      time.Time
+		expected time.Time
+	}{
+		{"RFC3339", "2026-01-15T06:30:00+01:00", time.Date(2026, 1, 15, 0, 0, 0, 0, loc), time.Date(2026, 1, 15, 6, 30, 0, 0, time.FixedZone("", 60*60))},
+		{"Later today", "06:30", time.Date(2026, 1, 15, 5, 0, 0, 0, loc), time.Date(2026, 1, 15, 6, 30, 0, 0, loc)},
+		{"Tomorrow", "06:30", time.Date(2026, 1, 15, 7, 0, 0, 0, loc), time.Date(2026, 1, 16, 6, 30, 0, 0, loc)},
+		{"Now means tomorrow", "06:30", time.Date(2026, 1, 15, 6, 30, 0, 0, loc), time.Date(2026, 1, 16, 6, 30, 0, 0, loc)},
+		{"Across DST start", "06:30", time.Date(2026, 3, 28, 22, 0, 0, 0, loc), time.Date(2026, 3, 29, 6, 30, 0, 0, loc)},
+		{"Now in other zone", "06:30", time.Date(2026, 1, 15, 23, 0, 0, 0, time.FixedZone("", -8*60*60)), time.Date(2026, 1, 17, 6, 30, 0, 0, loc)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			end, err := parseDeadline(tc.input, tc.now, loc)
+			if err != nil {
+				t.Fatalf("parseDeadline failed: %v", err)
+			}
+			if !end.Equal(tc.expected) {
+				t.Errorf("parseDeadline = %v, expected %v", end, tc.expected)
+			}
+			if end.Format(time.RFC3339) != tc.expected.Format(time.RFC3339) {
+				t.Errorf("Formatted = %s, expected %s", end.Format(time.RFC3339), tc.expected.Format(time.RFC3339))
+			}
+		})
+	}
+
+	for _, input := range []string{"", "6:30pm", "24:00", "2026-01-15"} {
+		if _, err := parseDeadline(input, time.Now(), loc); err == nil {
+			t.Errorf("parseDeadline(%q) succeeded, expected error", input)
+		}
+	}
+}
+
 // TestTimerHandlerPUTOversizedBody tests request body size limit
 func TestTimerHandlerPUTOversizedBody(t *testing.T) {
 	timer := NewSecondsTimer(time.Hour)
 	defer timer.Stop()
 
-	handler := timerHandler(timer)
+	handler := timerHandler(namedTimerFor(timer))
 
 	// Create payload larger than maxRequestBodyBytes (1024)
 	largePayload := `{"seconds":60,"padding":"` + strings.Repeat("x", 2000) + `"}`
@@ -214,9 +523,9 @@ func TestTimerHandlerUnsupportedMethod(t *testing.T) {
 	timer := NewSecondsTimer(time.Hour)
 	defer timer.Stop()
 
-	handler := timerHandler(timer)
+	handler := timerHandler(namedTimerFor(timer))
 
-	methods := []string{http.MethodPost, http.MethodDelete, http.MethodPatch, http.MethodHead}
+	methods := []string{http.MethodPost, http.MethodPatch, http.MethodHead}
 
 	for _, method := range methods {
 		t.Run(method, func(t *testing.T) {
@@ -236,12 +545,189 @@ func TestTimerHandlerUnsupportedMethod(t *testing.T) {
 	}
 }
 
+// TestTimerHandlerDELETE tests cancelling the timer
+func TestTimerHandlerDELETE(t *testing.T) {
+	timer := NewSecondsTimer(time.Hour)
+	handler := timerHandler(namedTimerFor(timer))
+
+	req := httptest.NewRequest(http.MethodDelete, "/timer", nil)
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("DELETE returned status %d, expected %d", rec.Code, http.StatusOK)
+	}
+	if timer.State() != StateCancelled {
+		t.Errorf("State = %s, expected %s", timer.State(), StateCancelled)
+	}
+
+	// Nothing left to cancel
+	rec = httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Second DELETE returned status %d, expected %d", rec.Code, http.StatusConflict)
+	}
+}
+
+// TestTimerActionPauseResume tests pausing and resuming the timer
+func TestTimerActionPauseResume(t *testing.T) {
+	timer, clock := newFakeTimer(time.Hour)
+	clock.Advance(time.Minute)
+
+	pause := timerActionHandler(namedTimerFor(timer), actionPause)
+	resume := timerActionHandler(namedTimerFor(timer), actionResume)
+
+	rec := httptest.NewRecorder()
+	pause(rec, httptest.NewRequest(http.MethodPost, "/timer/pause", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Pause returned status %d, expected %d", rec.Code, http.StatusOK)
+	}
+	if timer.State() != StatePaused {
+		t.Errorf("State = %s, expected %s", timer.State(), StatePaused)
+	}
+	clock.Advance(time.Hour)
+
+	// Pausing twice conflicts
+	rec = httptest.NewRecorder()
+	pause(rec, httptest.NewRequest(http.MethodPost, "/timer/pause", nil))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Second pause returned status %d, expected %d", rec.Code, http.StatusConflict)
+	}
+
+	rec = httptest.NewRecorder()
+	resume(rec, httptest.NewRequest(http.MethodPost, "/timer/resume", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Resume returned status %d, expected %d", rec.Code, http.StatusOK)
+	}
+	if remaining := timer.TimeRemaining(); remaining != 59*time.Minute {
+		t.Errorf("TimeRemaining after resume = %v, expected 59m", remaining)
+	}
+
+	rec = httptest.NewRecorder()
+	resume(rec, httptest.NewRequest(http.MethodPost, "/timer/resume", nil))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Second resume returned status %d, expected %d", rec.Code, http.StatusConflict)
+	}
+}
+
+// TestTimerActionAdd tests adding and subtracting seconds
+func TestTimerActionAdd(t *testing.T) {
+	testCases := []struct {
+		name           string
+		start          time.Duration
+		payload        string
+		expectedStatus int
+		expected       time.Duration
+	}{
+		{"Add", time.Minute, `{"seconds":60}`, http.StatusOK, 2 * time.Minute},
+		{"Subtract", time.Minute, `{"seconds":-30}`, http.StatusOK, 30 * time.Second},
+		{"Below zero", time.Minute, `{"seconds":-120}`, http.StatusBadRequest, time.Minute},
+		{"Above maximum", time.Minute, fmt.Sprintf(`{"seconds":%d}`, maxTimerSeconds), http.StatusBadRequest, time.Minute},
+		{"Wrapping around", time.Minute, `{"seconds":36028797018967568}`, http.StatusBadRequest, time.Minute},
+		{"Wrapping around negative", time.Minute, `{"seconds":-36028797018963968}`, http.StatusBadRequest, time.Minute},
+		{"Invalid JSON", time.Minute, `{"seconds":`, http.StatusBadRequest, time.Minute},
+		{"No seconds", time.Minute, `{}`, http.StatusBadRequest, time.Minute},
+		{"Absolute time", time.Minute, `{"at":"12:00"}`, http.StatusBadRequest, time.Minute},
+		{"Seconds and absolute time", time.Minute, `{"seconds":60,"at":"12:00"}`, http.StatusBadRequest, time.Minute},
+		{"Oversized body", time.Minute, `{"seconds":60,"padding":"` + strings.Repeat("x", 2000) + `"}`, http.StatusBadRequest, time.Minute},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			timer, _ := newFakeTimer(tc.start)
+
+			handler := timerActionHandler(namedTimerFor(timer), actionAdd)
+			req := httptest.NewRequest(http.MethodPost, "/timer/add", strings.NewReader(tc.payload))
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Errorf("Status = %d, expected %d. Body: %s", rec.Code, tc.expectedStatus, rec.Body.String())
+			}
+
+			if remaining := timer.TimeRemaining(); remaining != tc.expected {
+				t.Errorf("TimeRemaining = %v, expected %v", remaining, tc.expected)
+			}
+		})
+	}
+}
+
+// TestTimerActionAddNotRunning tests adding seconds to a timer that is not running
+func TestTimerActionAddNotRunning(t *testing.T) {
+	timer := NewIdleTimer()
+
+	handler := timerActionHandler(namedTimerFor(timer), actionAdd)
+	req := httptest.NewRequest(http.MethodPost, "/timer/add", strings.NewReader(`{"seconds":60}`))
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Status = %d, expected %d", rec.Code, http.StatusConflict)
+	}
+	if timer.State() != StateIdle {
+		t.Errorf("State = %s, expected %s", timer.State(), StateIdle)
+	}
+}
+
+// TestTimerActionUnsupportedMethod tests that actions only accept POST
+func TestTimerActionUnsupportedMethod(t *testing.T) {
+	timer := NewSecondsTimer(time.Hour)
+	defer timer.Stop()
+
+	handler := timerActionHandler(namedTimerFor(timer), actionPause)
+	req := httptest.NewRequest(http.MethodGet, "/timer/pause", nil)
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusNotImplemented {
+		t.Errorf("GET returned status %d, expected %d", rec.Code, http.StatusNotImplemented)
+	}
+	if timer.State() != StateArmed {
+		t.Errorf("State = %s, expected %s", timer.State(), StateArmed)
+	}
+}
+
+// TestTimersHandler tests listing all timers
+func TestTimersHandler(t *testing.T) {
+	ts := newTimerSet([]string{"a", "b"}, hap.NewMemStore(), timerConfig{})
+	ts.Get("b").Timer.Reset(time.Hour)
+	defer ts.Get("b").Timer.Stop()
+
+	handler := timersHandler(ts)
+	req := httptest.NewRequest(http.MethodGet, "/timers", nil)
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET returned status %d, expected %d", rec.Code, http.StatusOK)
+	}
+
+	var response []outputNamedTimer
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+	if len(response) != 2 || response[0].Name != "a" || response[1].Name != "b" {
+		t.Fatalf("Response = %+v, expected timers a and b in order", response)
+	}
+	if response[0].State != StateIdle || response[1].State != StateArmed {
+		t.Errorf("States = %s, %s; expected idle, armed", response[0].State, response[1].State)
+	}
+
+	// Listing is read-only
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPut, "/timers", nil))
+	if rec.Code != http.StatusNotImplemented {
+		t.Errorf("PUT returned status %d, expected %d", rec.Code, http.StatusNotImplemented)
+	}
+}
+
 // TestTimerHandlerConcurrent tests concurrent requests
 func TestTimerHandlerConcurrent(t *testing.T) {
 	timer := NewSecondsTimer(time.Hour)
 	defer timer.Stop()
 
-	handler := timerHandler(timer)
+	handler := timerHandler(namedTimerFor(timer))
 
 	// Launch multiple concurrent requests
 	const concurrency = 50
@@ -281,7 +767,8 @@ func TestTimerHandlerConcurrent(t *testing.T) {
 
 // TestInputTimerJSON tests inputTimer JSON marshaling
 func TestInputTimerJSON(t *testing.T) {
-	input := inputTimer{Seconds: 123}
+	seconds := timerSeconds(123)
+	input := inputTimer{Seconds: &seconds}
 
 	data, err := json.Marshal(input)
 	if err != nil {
@@ -299,16 +786,18 @@ func TestInputTimerJSON(t *testing.T) {
 		t.Fatalf("Failed to unmarshal: %v", err)
 	}
 
-	if decoded.Seconds != input.Seconds {
-		t.Errorf("Decoded seconds = %d, expected %d", decoded.Seconds, input.Seconds)
+	if decoded.seconds() != input.seconds() {
+		t.Errorf("Decoded seconds = %d, expected %d", decoded.seconds(), input.seconds())
 	}
 }
 
 // TestOutputTimerJSON tests outputTimer JSON marshaling
 func TestOutputTimerJSON(t *testing.T) {
+	end := "2026-01-15T12:00:00Z"
 	output := outputTimer{
+		State:   StateArmed,
 		Seconds: 456,
-		End:     "2026-01-15T12:00:00Z",
+		End:     &end,
 	}
 
 	data, err := json.Marshal(output)
@@ -324,6 +813,12 @@ func TestOutputTimerJSON(t *testing.T) {
 	if !strings.Contains(str, `"end":"2026-01-15T12:00:00Z"`) {
 		t.Errorf("JSON missing end field: %s", str)
 	}
+	if !strings.Contains(str, `"state":"armed"`) {
+		t.Errorf("JSON missing state field: %s", str)
+	}
+	if !strings.Contains(str, `"last_fired":null`) {
+		t.Errorf("JSON missing null last_fired field: %s", str)
+	}
 }
 
 // BenchmarkTimerHandlerGET benchmarks GET requests
@@ -331,7 +826,7 @@ func BenchmarkTimerHandlerGET(b *testing.B) {
 	timer := NewSecondsTimer(time.Hour)
 	defer timer.Stop()
 
-	handler := timerHandler(timer)
+	handler := timerHandler(namedTimerFor(timer))
 	req := httptest.NewRequest(http.MethodGet, "/timer", nil)
 
 	b.ResetTimer()
@@ -346,7 +841,7 @@ func BenchmarkTimerHandlerPUT(b *testing.B) {
 	timer := NewSecondsTimer(time.Hour)
 	defer timer.Stop()
 
-	handler := timerHandler(timer)
+	handler := timerHandler(namedTimerFor(timer))
 	payload := `{"seconds":60}`
 
 	b.ResetTimer()
@@ -357,3 +852,146 @@ func BenchmarkTimerHandlerPUT(b *testing.B) {
 		handler(rec, req)
 	}
 }
+
+// TestSchedulesHandler tests adding, listing and deleting schedules
+func TestSchedulesHandler(t *testing.T) {
+	nt := namedTimerFor(NewIdleTimer())
+	handler := schedulesHandler(nt, "/timer/schedules")
+
+	// Add a schedule
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/timer/schedules", strings.NewReader(`{"cron":"30 7 * * MON-FRI"}`)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST returned status %d, expected %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+	var added struct {
+		Success bool   `json:"success"`
+		ID      string `json:"id"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &added); err != nil || !added.Success || added.ID == "" {
+		t.Fatalf("POST response = %s, expected success and id", rec.Body.String())
+	}
+
+	// List it with upcoming fire times
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/timer/schedules", nil))
+	var list []outputSchedule
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+	if len(list) != 1 || list[0].ID != added.ID || len(list[0].NextFires) != upcomingFires {
+		t.Fatalf("GET response = %+v, expected schedule %s with %d fire times", list, added.ID, upcomingFires)
+	}
+
+	// The timer status reports the next fires too
+	rec = httptest.NewRecorder()
+	timerHandler(nt)(rec, httptest.NewRequest(http.MethodGet, "/timer", nil))
+	var status outputTimer
+	json.Unmarshal(rec.Body.Bytes(), &status)
+	if len(status.NextFires) != upcomingFires || status.NextFires[0] != list[0].NextFires[0] {
+		t.Errorf("Timer next_fires = %v, expected %v", status.NextFires, list[0].NextFires)
+	}
+
+	// Delete it
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodDelete, "/timer/schedules/"+added.ID, nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("DELETE returned status %d, expected %d", rec.Code, http.StatusOK)
+	}
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodDelete, "/timer/schedules/"+added.ID, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Second DELETE returned status %d, expected %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+// TestSchedulesHandlerInvalid tests rejected schedule requests
+func TestSchedulesHandlerInvalid(t *testing.T) {
+	handler := schedulesHandler(namedTimerFor(NewIdleTimer()), "/timer/schedules")
+
+	testCases := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"Invalid cron", http.MethodPost, "/timer/schedules", `{"cron":"25 * * * *  *"}`, http.StatusBadRequest},
+		{"Unknown field", http.MethodPost, "/timer/schedules", `{"cron":"@daily","at":"07:00"}`, http.StatusBadRequest},
+		{"Invalid JSON", http.MethodPost, "/timer/schedules", `{`, http.StatusBadRequest},
+		{"DELETE without id", http.MethodDelete, "/timer/schedules", "", http.StatusNotImplemented},
+		{"PUT", http.MethodPut, "/timer/schedules", `{"cron":"@daily"}`, http.StatusNotImplemented},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body)))
+			if rec.Code != tc.status {
+				t.Errorf("%s returned status %d, expected %d", tc.method, rec.Code, tc.status)
+			}
+		})
+	}
+}
+
+// TestTimerHandlerGETWait verifies GET ?wait= returns once the state changes or the wait expires
+func TestTimerHandlerGETWait(t *testing.T) {
+	testCases := []struct {
+		name   string
+		wait   string
+		change func(nt *namedTimer, clock *fakeClock)
+		event  string
+		state  TimerState
+	}{
+		{"Fired", "20", func(nt *namedTimer, clock *fakeClock) { clock.Advance(10 * time.Second) }, string(StateFired), StateFired},
+		{"Cancelled", "20", func(nt *namedTimer, clock *fakeClock) { nt.Timer.Stop() }, string(StateCancelled), StateCancelled},
+		{"Timeout", "5", func(nt *namedTimer, clock *fakeClock) { clock.Advance(5 * time.Second) }, waitEventTimeout, StateArmed},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			timer, clock := newFakeTimer(10 * time.Second)
+			nt := namedTimerFor(timer)
+			nt.Timer.OnChange(func(status TimerStatus) {
+				nt.publishTimer(string(status.State), status)
+			})
+
+			rec := httptest.NewRecorder()
+			done := make(chan struct{})
+			go func() {
+				timerHandler(nt)(rec, httptest.NewRequest(http.MethodGet, "/timer?wait="+tc.wait, nil))
+				close(done)
+			}()
+
+			// The countdown and the wait timeout are pending once the handler waits
+			clock.WaitPending(2)
+			select {
+			case <-done:
+				t.Fatal("GET returned before the timer changed")
+			default:
+			}
+			tc.change(nt, clock)
+			<-done
+
+			var response outputWait
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse JSON response: %v", err)
+			}
+			if response.Event != tc.event || response.State != tc.state {
+				t.Errorf("Response event %s state %s, expected %s %s", response.Event, response.State, tc.event, tc.state)
+			}
+		})
+	}
+}
+
+// TestTimerHandlerGETWaitInvalid verifies out of range waits are rejected
+func TestTimerHandlerGETWaitInvalid(t *testing.T) {
+	nt := namedTimerFor(NewIdleTimer())
+	for _, wait := range []string{"0", "-1", "3601", "soon"} {
+		rec := httptest.NewRecorder()
+		timerHandler(nt)(rec, httptest.NewRequest(http.MethodGet, "/timer?wait="+wait, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("GET ?wait=%s returned status %d, expected %d", wait, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
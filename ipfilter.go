@@ -0,0 +1,188 @@
+package main
+
+import (
+	"github.com/brutella/hap"
+
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+)
+
+// ipFilter limits which client addresses may use the HTTP API.
+type ipFilter struct {
+	allow   []netip.Prefix // if set, only these clients are served
+	deny    []netip.Prefix // never served, even if allowed
+	proxies []netip.Prefix // trusted to report the client in X-Forwarded-For
+
+	rejected atomic.Int64 // requests rejected so far
+}
+
+// outputFilter represents the JSON response for GET /admin/filter.
+type outputFilter struct {
+	Rejected int64 `json:"rejected"` // Requests rejected since hktimer started
+}
+
+// parsePrefixes parses a comma-separated list of CIDR prefixes, like
+// 192.168.1.0/24, or single addresses.
+func parsePrefixes(list string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q", s)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid prefix %q", s)
+		}
+		if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// newIPFilter creates a filter from the comma-separated -allow, -deny and
+// -trusted-proxies lists.
+func newIPFilter(allow, deny, proxies string) (*ipFilter, error) {
+	f := &ipFilter{}
+	var err error
+	if f.allow, err = parsePrefixes(allow); err != nil {
+		return nil, fmt.Errorf("allow: %w", err)
+	}
+	if f.deny, err = parsePrefixes(deny); err != nil {
+		return nil, fmt.Errorf("deny: %w", err)
+	}
+	if f.proxies, err = parsePrefixes(proxies); err != nil {
+		return nil, fmt.Errorf("trusted proxies: %w", err)
+	}
+	return f, nil
+}
+
+// containsAddr reports whether one of prefixes contains addr.
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientAddr returns the address of the client making req. Requests from a
+// trusted proxy are attributed to the last address in X-Forwarded-For that
+// isn't a trusted proxy itself. It returns an invalid address if the
+// address can't be parsed.
+func (f *ipFilter) ClientAddr(req *http.Request) netip.Addr {
+	addrPort, err := netip.ParseAddrPort(req.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}
+	}
+	addr := addrPort.Addr().Unmap()
+	if !containsAddr(f.proxies, addr) {
+		return addr
+	}
+
+	// Every proxy appends the address it got the request from
+	var forwarded []string
+	for _, value := range req.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(value, ",")...)
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			return netip.Addr{}
+		}
+		addr = hop.Unmap()
+		if !containsAddr(f.proxies, addr) {
+			break
+		}
+	}
+	return addr
+}
+
+// Allowed reports whether addr may use the API: it is not denied, and
+// allowed if an allowlist is configured.
+func (f *ipFilter) Allowed(addr netip.Addr) bool {
+	if !addr.IsValid() || containsAddr(f.deny, addr) {
+		return false
+	}
+	return len(f.allow) == 0 || containsAddr(f.allow, addr)
+}
+
+// Rejected returns how many requests were rejected.
+func (f *ipFilter) Rejected() int64 {
+	return f.rejected.Load()
+}
+
+// filterHandler reports how many requests f rejected. It only supports GET.
+func filterHandler(f *ipFilter) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			log.Printf("HTTP request not supported")
+			http.Error(res, "Not supported", http.StatusNotImplemented)
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(res).Encode(outputFilter{Rejected: f.Rejected()})
+	}
+}
+
+// Require wraps next so it is only served for allowed clients. Others get
+// 403 Forbidden and are counted. Requests over a Unix socket have no client
+// address and are always served; the socket's permissions decide who may
+// connect.
+func (f *ipFilter) Require(next http.HandlerFunc) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		if local, ok := req.Context().Value(http.LocalAddrContextKey).(net.Addr); ok && local.Network() == "unix" {
+			next(res, req)
+			return
+		}
+		addr := f.ClientAddr(req)
+		if !f.Allowed(addr) {
+			n := f.rejected.Add(1)
+			securityLog.Printf("Rejected %s %s from %s (%s), %d rejected so far", req.Method, req.URL.Path, addr, req.RemoteAddr, n)
+			http.Error(res, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next(res, req)
+	}
+}
+
+// filterMux registers handlers on a hap.ServeMux behind an ipFilter.
+type filterMux struct {
+	hap.ServeMux
+	filter *ipFilter
+}
+
+// Protect returns mux with every handler registered through it limited to
+// allowed clients, see Require.
+func (f *ipFilter) Protect(mux hap.ServeMux) hap.ServeMux {
+	return filterMux{mux, f}
+}
+
+func (m filterMux) Handle(pattern string, handler http.Handler) {
+	m.ServeMux.Handle(pattern, m.filter.Require(handler.ServeHTTP))
+}
+
+func (m filterMux) HandleFunc(pattern string, handler http.HandlerFunc) {
+	m.ServeMux.HandleFunc(pattern, m.filter.Require(handler))
+}
+
+func (m filterMux) Mount(pattern string, handler http.Handler) {
+	m.ServeMux.Mount(pattern, m.filter.Require(handler.ServeHTTP))
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+// TestParsePrefixes verifies CIDR lists with single and mapped addresses
+func TestParsePrefixes(t *testing.T) {
+	prefixes, err := parsePrefixes(" 192.168.1.0/24, 10.0.0.7 ,fd00::/8,::ffff:172.16.0.0/108,192.168.2.9/24,")
+	if err != nil {
+		t.Fatalf("parsePrefixes failed: %v", err)
+	}
+	expected := []string{"192.168.1.0/24", "10.0.0.7/32", "fd00::/8", "172.16.0.0/12", "192.168.2.0/24"}
+	if len(prefixes) != len(expected) {
+		t.Fatalf("Prefixes = %v, expected %v", prefixes, expected)
+	}
+	for i, p := range prefixes {
+		if p.String() != expected[i] {
+			t.Errorf("Prefix %d = %s, expected %s", i, p, expected[i])
+		}
+	}
+
+	for _, list := range []string{"192.168.1.0/33", "lan", "192.168.1/24"} {
+		if _, err := parsePrefixes(list); err == nil {
+			t.Errorf("parsePrefixes(%q) succeeded, expected error", list)
+		}
+	}
+}
+
+// TestIPFilterAllowed verifies the allowlist and the denylist taking precedence
+func TestIPFilterAllowed(t *testing.T) {
+	f, err := newIPFilter("192.168.1.0/24", "192.168.1.66", "")
+	if err != nil {
+		t.Fatalf("newIPFilter failed: %v", err)
+	}
+	for addr, allowed := range map[string]bool{
+		"192.168.1.10":       true,
+		"192.168.1.66":       false,
+		"192.168.2.10":       false,
+		"::ffff:192.168.1.9": false, // Callers unmap, see ClientAddr
+	} {
+		if got := f.Allowed(netip.MustParseAddr(addr)); got != allowed {
+			t.Errorf("Allowed(%s) = %v, expected %v", addr, got, allowed)
+		}
+	}
+	if f.Allowed(netip.Addr{}) {
+		t.Error("Invalid address allowed")
+	}
+
+	// Without an allowlist everyone but the denied is allowed
+	f, _ = newIPFilter("", "10.0.0.0/8", "")
+	if !f.Allowed(netip.MustParseAddr("192.168.1.10")) || f.Allowed(netip.MustParseAddr("10.1.2.3")) {
+		t.Error("Denylist alone not applied")
+	}
+}
+
+// TestIPFilterClientAddr verifies X-Forwarded-For is only trusted from proxies
+func TestIPFilterClientAddr(t *testing.T) {
+	f, _ := newIPFilter("", "", "127.0.0.1, 10.0.0.0/8")
+	testCases := []struct {
+		name      string
+		remote    string
+		forwarded []string
+		client    string
+	}{
+		{"Direct", "192.168.1.10:5000", nil, "192.168.1.10"},
+		{"Untrusted forward", "192.168.1.10:5000", []string{"192.168.1.99"}, "192.168.1.10"},
+		{"Trusted proxy", "127.0.0.1:5000", []string{"192.168.1.99"}, "192.168.1.99"},
+		{"Proxy chain", "127.0.0.1:5000", []string{"203.0.113.5, 192.168.1.99", "10.0.0.2"}, "192.168.1.99"},
+		{"Spoofed start", "127.0.0.1:5000", []string{"192.168.1.99, 203.0.113.5"}, "203.0.113.5"},
+		{"Proxy without header", "127.0.0.1:5000", nil, "127.0.0.1"},
+		{"Mapped", "[::ffff:192.168.1.10]:5000", nil, "192.168.1.10"},
+		{"Invalid forward", "127.0.0.1:5000", []string{"unknown"}, "invalid IP"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/timer", nil)
+			req.RemoteAddr = tc.remote
+			for _, value := range tc.forwarded {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			if client := f.ClientAddr(req).String(); client != tc.client {
+				t.Errorf("ClientAddr = %s, expected %s", client, tc.client)
+			}
+		})
+	}
+}
+
+// TestIPFilterRequire verifies rejected requests get 403 and are counted
+func TestIPFilterRequire(t *testing.T) {
+	f, _ := newIPFilter("192.168.1.0/24", "", "")
+	var served int
+	handler := f.Require(func(res http.ResponseWriter, req *http.Request) { served++ })
+
+	for _, remote := range []string{"192.168.1.10:5000", "203.0.113.5:5000", "192.168.2.10:5000"} {
+		req := httptest.NewRequest(http.MethodPut, "/timer", nil)
+		req.RemoteAddr = remote
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if allowed := remote == "192.168.1.10:5000"; allowed != (rec.Code == http.StatusOK) {
+			t.Errorf("Request from %s returned status %d", remote, rec.Code)
+		}
+	}
+	if served != 1 || f.Rejected() != 2 {
+		t.Errorf("Served %d and rejected %d requests, expected 1 and 2", served, f.Rejected())
+	}
+
+	// Operators read the count from the admin endpoint
+	rec := httptest.NewRecorder()
+	filterHandler(f)(rec, httptest.NewRequest(http.MethodGet, "/admin/filter", nil))
+	if body := strings.TrimSpace(rec.Body.String()); rec.Code != http.StatusOK || body != `{"rejected":2}` {
+		t.Errorf("GET /admin/filter = %d %s, expected {\"rejected\":2}", rec.Code, body)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// unixPrefix marks -api-listen addresses of Unix sockets.
+const unixPrefix = "unix:"
+
+// apiShutdownTimeout is how long the API listener waits for requests in
+// progress when stopping, a variable so tests can shorten it.
+var apiShutdownTimeout = 5 * time.Second
+
+// apiMux serves the HTTP API on its own listener. It registers handlers
+// like the HAP server's mux does, turning its subtree patterns ending in /*
+// into those of http.ServeMux ending in /.
+type apiMux struct {
+	*http.ServeMux
+}
+
+// newAPIMux creates an empty mux.
+func newAPIMux() apiMux {
+	return apiMux{http.NewServeMux()}
+}
+
+func (m apiMux) Handle(pattern string, handler http.Handler) {
+	if subtree, ok := strings.CutSuffix(pattern, "/*"); ok {
+		pattern = subtree + "/"
+	}
+	m.ServeMux.Handle(pattern, handler)
+}
+
+func (m apiMux) HandleFunc(pattern string, handler http.HandlerFunc) {
+	m.Handle(pattern, handler)
+}
+
+func (m apiMux) Mount(pattern string, handler http.Handler) {
+	m.Handle(strings.TrimSuffix(pattern, "/")+"/*", handler)
+}
+
+// parseSocketMode parses the octal file mode of Unix sockets, like 0660.
+func parseSocketMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode > 0o777 {
+		return 0, fmt.Errorf("invalid file mode %q, expected octal permissions like 0660", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// listenAPI listens on addr, a TCP address like 127.0.0.1:8080 or a Unix
+// socket like unix:/var/run/hktimer.sock. The socket is created with mode,
+// replacing a socket left over from an earlier run.
+func listenAPI(addr string, mode os.FileMode) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, unixPrefix)
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	if path == "" {
+		return nil, errors.New("missing socket path")
+	}
+
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// serveAPI serves handler on ln until ctx is cancelled, then waits up to
+// apiShutdownTimeout for requests in progress. Requests see ctx cancelled,
+// so long polls and event streams end right away. Unix sockets are removed
+// when ln is closed.
+func serveAPI(ctx context.Context, ln net.Listener, handler http.Handler) error {
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), apiShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("API listener shutdown: %s", err)
+			server.Close()
+		}
+	}()
+
+	log.Printf("Serving the HTTP API on %s", ln.Addr())
+	err := server.Serve(ln)
+	if errors.Is(err, http.ErrServerClosed) {
+		<-stopped
+		return nil
+	}
+	return err
+}
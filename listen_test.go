@@ -0,0 +1,140 @@
+package main
+
+import (
+	"github.com/brutella/hap"
+
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestAPIMux verifies the timer routes work on the dedicated mux, including subtree patterns
+func TestAPIMux(t *testing.T) {
+	ts := newTimerSet([]string{defaultTimerName}, hap.NewMemStore(), timerConfig{})
+	mux := newAPIMux()
+	registerTimerSetRoutes(t.Context(), mux, ts)
+
+	for _, tc := range []struct {
+		method, path string
+		code         int
+	}{
+		{http.MethodGet, "/timer", http.StatusOK},
+		{http.MethodGet, "/timers/timer/schedules", http.StatusOK},
+		{http.MethodDelete, "/timer/schedules/missing", http.StatusNotFound},
+		{http.MethodGet, "/unknown", http.StatusNotFound},
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.path, nil))
+		if rec.Code != tc.code {
+			t.Errorf("%s %s returned status %d, expected %d", tc.method, tc.path, rec.Code, tc.code)
+		}
+	}
+}
+
+// TestParseSocketMode verifies octal permissions
+func TestParseSocketMode(t *testing.T) {
+	if mode, err := parseSocketMode("0660"); err != nil || mode != 0o660 {
+		t.Errorf("parseSocketMode(0660) = %o, %v", mode, err)
+	}
+	for _, s := range []string{"", "rw", "0888", "01777"} {
+		if _, err := parseSocketMode(s); err == nil {
+			t.Errorf("parseSocketMode(%q) succeeded, expected error", s)
+		}
+	}
+}
+
+// TestListenAPIUnix verifies sockets get their mode and stale ones are replaced
+func TestListenAPIUnix(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hktimer.sock")
+
+	// A socket left over from a crashed run
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := listenAPI(unixPrefix+path, 0o600)
+	if err != nil {
+		t.Fatalf("listenAPI failed: %v", err)
+	}
+	defer ln.Close()
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("Socket mode = %v, %v, expected 0600", info.Mode(), err)
+	}
+
+	// Other files are left alone
+	file := filepath.Join(dir, "file")
+	os.WriteFile(file, nil, 0o600)
+	if _, err := listenAPI(unixPrefix+file, 0o600); err == nil {
+		t.Error("listenAPI replaced a regular file")
+	}
+}
+
+// TestServeAPIShutdown verifies the listener stops with the context, ending long polls
+func TestServeAPIShutdown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hktimer.sock")
+	ln, err := listenAPI(unixPrefix+path, 0o600)
+	if err != nil {
+		t.Fatalf("listenAPI failed: %v", err)
+	}
+
+	nt := newNamedTimer(defaultTimerName, hap.NewMemStore(), timerConfig{})
+	mux := newAPIMux()
+	filter, _ := newIPFilter("192.168.1.0/24", "", "")
+	filter.Protect(mux).HandleFunc("/timer", timerHandler(nt))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- serveAPI(ctx, ln, mux)
+	}()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	res, err := client.Get("http://hktimer/timer")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("GET over the socket returned status %d, expected it to pass the client filter", res.StatusCode)
+	}
+
+	// A long poll in progress doesn't hold up the shutdown
+	polling := make(chan struct{})
+	go func() {
+		defer close(polling)
+		if res, err := client.Get("http://hktimer/timer?wait=60"); err == nil {
+			res.Body.Close()
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("serveAPI returned %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("serveAPI didn't stop")
+	}
+	<-polling
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Socket not removed: %v", err)
+	}
+}
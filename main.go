@@ -2,21 +2,47 @@
 // via both HomeKit and an HTTP API. When the timer expires, it automatically
 // turns on a virtual HomeKit switch.
 //
+// Alternatively each timer can be served as a HomeKit valve, which shows the
+// countdown in the Home app and lets users set and cancel it there, or as an
+// outlet, a stateless button or a contact, motion or occupancy sensor that
+// signals the fire. An optional occupancy sensor shows whether a countdown is
+// pending.
+//
+// Several named timers can be served at once. Each gets its own switch, bridged
+// through a single HomeKit accessory, and its own /timers/{name} endpoints
+// mirroring the /timer endpoints below.
+//
 // The HTTP API supports:
+//   - GET /timers: List all timers
 //   - GET /timer: Check timer status
 //   - PUT /timer: Set timer duration (0 to 30 days)
+//   - DELETE /timer: Cancel the countdown
+//   - POST /timer/pause, /timer/resume: Pause and resume the countdown
+//   - POST /timer/add: Add or subtract seconds from the countdown
+//   - GET, POST /timer/schedules: List and add recurring cron schedules
+//   - DELETE /timer/schedules/{id}: Remove a schedule
+//   - GET /timer/events: Stream timer and switch changes as Server-Sent Events
+//   - GET /webhooks: Show the delivery status of the webhooks
+//   - GET /admin/pairings, DELETE /admin/pairings/{id}: Manage HomeKit pairings
+//   - POST /admin/reset: Remove all pairings and the HAP identity
+//
+// Requests can be required to carry bearer tokens, scoped to reading,
+// controlling the timers or managing pairings.
+//
+// Timer events can also call webhooks and run a local command.
 //
 // The implementation is thread-safe and supports graceful shutdown.
 package main
 
 import (
 	"github.com/brutella/hap"
-	"github.com/brutella/hap/accessory"
 
 	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"os/signal"
 	"syscall"
@@ -27,6 +53,46 @@ import (
 var (
 	port     = flag.Int("port", 30001, "HTTP server port (1-65535)")
 	useNvram = flag.Bool("nvram", false, "Use NVRAM storage instead of filesystem (for FreshTomato routers)")
+
+	apiListen     = flag.String("api-listen", "", "Serve the HTTP API on this TCP address, e.g. 127.0.0.1:8080, or Unix socket, e.g. unix:/var/run/hktimer.sock, instead of the HomeKit port")
+	apiSocketMode = flag.String("api-socket-mode", "0660", "File permissions of the -api-listen Unix socket")
+	apiTLSCert    = flag.String("api-tls-cert", "", "PEM certificate file to serve the -api-listen listener over TLS")
+	apiTLSKey     = flag.String("api-tls-key", "", "PEM private key file of -api-tls-cert")
+	apiSelfSigned = flag.Bool("api-tls-self-signed", false, "Serve the -api-listen listener over TLS with a self-signed certificate kept in storage")
+
+	timerNames    = flag.String("timers", defaultTimerName, "Comma-separated timer names, each with its own HomeKit switch")
+	accessoryType = flag.String("accessory", accessorySwitch, "HomeKit accessory per timer: switch, outlet, button, contact, motion, occupancy, or valve to show and set the countdown in the Home app")
+	armedSensor   = flag.Bool("armed-sensor", false, "Add an occupancy sensor per timer that detects occupancy while the countdown is armed")
+	pulse         = flag.Duration("pulse", 0, "Turn the switch off again this long after firing (0 keeps it on until switched off, sensors reset after 5s)")
+
+	switchOff       = flag.String("switch-off", switchOffIgnore, "When the switch is turned off in HomeKit: ignore, cancel or rearm the countdown")
+	switchOn        = flag.String("switch-on", switchOnIgnore, "When the switch is turned on in HomeKit: ignore, fire, or arm the default duration")
+	defaultDuration = flag.Duration("default-duration", 30*time.Minute, "Countdown armed by -switch-off rearm, -switch-on arm and a valve without a duration")
+
+	timeZone = flag.String("tz", "", "Time zone for local HH:MM times, e.g. Europe/London (default: system time zone)")
+
+	accessoryName = flag.String("name", "", "Accessory name shown when pairing (default: the timer name, or hktimer for a bridge)")
+	manufacturer  = flag.String("manufacturer", "", "Accessory manufacturer shown in the Home app")
+	model         = flag.String("model", "", "Accessory model shown in the Home app")
+	serialNumber  = flag.String("serial", "", "Accessory serial number shown in the Home app")
+	setupPin      = flag.String("pin", defaultSetupPin, "HomeKit setup code, 8 digits, optionally as XXX-XX-XXX")
+	setupID       = flag.String("setup-id", defaultSetupID, "HomeKit setup id in the setup URI, 4 digits or upper case letters")
+	webhooksFile  = flag.String("webhooks", "", "JSON file configuring webhooks called when timers fire, see README")
+	execCommand   = flag.String("exec", "", "Shell command run on timer events, with the event in HKTIMER_* environment variables, see README")
+	execEvents    = flag.String("exec-events", string(StateFired), "Comma-separated events running the -exec command: fired, armed, cancelled, paused, paired or unpaired")
+	execTimeout   = flag.Duration("exec-timeout", 30*time.Second, "Kill the -exec command if it runs longer than this")
+	adminToken    = flag.String("admin-token", "", "Bearer token for the /admin endpoints (default: $HKTIMER_ADMIN_TOKEN; unset disables them)")
+	readToken     = flag.String("read-token", "", "Bearer token for GET requests to the HTTP API (default: $HKTIMER_READ_TOKEN)")
+	controlToken  = flag.String("control-token", "", "Bearer token for all requests to the timer HTTP API (default: $HKTIMER_CONTROL_TOKEN)")
+	tokensFile    = flag.String("tokens", "", "File listing API tokens as scope:token, with scope read, control or admin")
+	tokensNvram   = flag.String("tokens-nvram", "", "NVRAM variable listing API tokens like -tokens")
+	allowIPs      = flag.String("allow", "", "Comma-separated CIDR prefixes of clients allowed to use the HTTP API, e.g. 192.168.1.0/24 (default: all)")
+	denyIPs       = flag.String("deny", "", "Comma-separated CIDR prefixes of clients never allowed to use the HTTP API")
+	proxyIPs      = flag.String("trusted-proxies", "", "Comma-separated CIDR prefixes of proxies trusted to report the client in X-Forwarded-For")
+
+	missedPolicy     = flag.String("missed", missedFire, "Policy for deadlines missed while stopped: fire, skip or grace")
+	graceWindow      = flag.Duration("missed-grace", 5*time.Minute, "How late a missed deadline may still fire with -missed grace")
+	nvramCommitTimer = flag.Bool("nvram-commit-timer", false, "Commit the armed timer to flash so it survives power loss (costs a flash write per change)")
 )
 
 func main() {
@@ -36,68 +102,234 @@ func main() {
 	if *port < 1 || *port > 65535 {
 		log.Fatalf("Port must be between 1 and 65535, got: %d", *port)
 	}
+	if !validMissedPolicy(*missedPolicy) {
+		log.Fatalf("Missed policy must be fire, skip or grace, got: %s", *missedPolicy)
+	}
+	names, err := parseTimerNames(*timerNames)
+	if err != nil {
+		log.Fatal("Invalid -timers: ", err)
+	}
+	if !validAccessory(*accessoryType) {
+		log.Fatalf("Accessory must be switch, outlet, button, contact, motion, occupancy or valve, got: %s", *accessoryType)
+	}
+	if *pulse < 0 {
+		log.Fatalf("Pulse must not be negative, got: %s", *pulse)
+	}
+	if *pulse > 0 && (*accessoryType == accessoryValve || *accessoryType == accessoryButton) {
+		log.Fatalf("Pulse doesn't apply to -accessory %s", *accessoryType)
+	}
+	if !validSwitchOffPolicy(*switchOff) {
+		log.Fatalf("Switch-off policy must be ignore, cancel or rearm, got: %s", *switchOff)
+	}
+	if !validSwitchOnPolicy(*switchOn) {
+		log.Fatalf("Switch-on policy must be ignore, fire or arm, got: %s", *switchOn)
+	}
+	pin, err := parseSetupPin(*setupPin)
+	if err != nil {
+		log.Fatal("Invalid -pin: ", err)
+	}
+	if !validSetupID(*setupID) {
+		log.Fatalf("Setup id must be 4 digits or upper case letters, got: %s", *setupID)
+	}
+	if *defaultDuration < minTimerSeconds*time.Second || *defaultDuration > maxTimerSeconds*time.Second {
+		log.Fatalf("Default duration must be between %d and %d seconds, got: %s", minTimerSeconds, maxTimerSeconds, *defaultDuration)
+	}
 
-	// Create a HomeKit switch accessory that can be controlled via HomeKit apps
-	a := accessory.NewSwitch(accessory.Info{
-		Name: "timer",
-	})
+	var webhookConfigs []webhookConfig
+	if *webhooksFile != "" {
+		if webhookConfigs, err = loadWebhooks(*webhooksFile); err != nil {
+			log.Fatal("Invalid -webhooks: ", err)
+		}
+	}
+	webhooks, err := newWebhookSet(webhookConfigs)
+	if err != nil {
+		log.Fatal("Invalid -webhooks: ", err)
+	}
 
-	// Log when the switch is controlled through HomeKit
-	a.Switch.On.OnValueRemoteUpdate(func(on bool) {
-		if on {
-			log.Println("Switching on remotely")
-		} else {
-			log.Println("Switching off remotely")
+	var hook *execHook
+	if *execCommand != "" {
+		if hook, err = newExecHook(*execCommand, *execEvents, *execTimeout); err != nil {
+			log.Fatal("Invalid -exec: ", err)
 		}
-	})
+	}
+
+	socketMode, err := parseSocketMode(*apiSocketMode)
+	if err != nil {
+		log.Fatal("Invalid -api-socket-mode: ", err)
+	}
+	useTLS := *apiTLSCert != "" || *apiTLSKey != "" || *apiSelfSigned
+	if useTLS && *apiListen == "" {
+		log.Fatal("TLS needs -api-listen, the HomeKit port can't serve it")
+	}
+	if (*apiTLSCert == "") != (*apiTLSKey == "") {
+		log.Fatal("-api-tls-cert and -api-tls-key must be given together")
+	}
+	if *apiTLSCert != "" && *apiSelfSigned {
+		log.Fatal("-api-tls-self-signed can't be combined with -api-tls-cert")
+	}
+	filter, err := newIPFilter(*allowIPs, *denyIPs, *proxyIPs)
+	if err != nil {
+		log.Fatal("Invalid client filter: ", err)
+	}
+	tokens, err := loadTokens()
+	if err != nil {
+		log.Fatal("Invalid API tokens: ", err)
+	}
+	if tokens.Open() {
+		log.Println("No read or control tokens configured, the timer HTTP API is open to anyone on the network")
+	}
+
+	location := time.Local
+	if *timeZone != "" {
+		if location, err = time.LoadLocation(*timeZone); err != nil {
+			log.Fatal("Invalid -tz: ", err)
+		}
+	}
 
 	// Select storage backend based on command-line flag
 	var store hap.Store
+	var syncCheck func() bool
 	if *useNvram {
 		log.Println("Using NVRAM storage")
-		store = NewNvramStore()
+		nvram := NewNvramStore()
+		for _, name := range names {
+			// Schedules change rarely and must survive reboots
+			nvram.CommitOn(schedulesKey(name))
+			if *nvramCommitTimer {
+				nvram.CommitOn(timerKey(name))
+			}
+		}
+		// A new certificate on every boot would break pinning
+		nvram.CommitOn(tlsCertKey)
+		nvram.CommitOn(tlsKeyKey)
+		store = nvram
+		syncCheck = nvramNTPReady
 	} else {
 		log.Println("Using filesystem storage (./db)")
 		store = hap.NewFsStore("./db")
 	}
 
+	// Report controllers pairing and unpairing, whatever the backend, to the
+	// log and event streams
+	events := newEventHub()
+	pairings := newPairingStore(store)
+	pairings.OnChange(events.publishPairing)
+	store = pairings
+	events.Listen(webhooks.Handle)
+	if hook != nil {
+		events.Listen(hook.Handle)
+	}
+
+	// Create an idle timer and a HomeKit switch for each name
+	// (timers won't fire until set via HTTP API)
+	timers := newTimerSet(names, store, timerConfig{
+		Accessory:       *accessoryType,
+		Pulse:           *pulse,
+		SwitchOff:       *switchOff,
+		SwitchOn:        *switchOn,
+		DefaultDuration: *defaultDuration,
+		ArmedSensor:     *armedSensor,
+		Location:        location,
+		SyncCheck:       syncCheck,
+		Events:          events,
+		Identity: accessoryIdentity{
+			Name:         *accessoryName,
+			Manufacturer: *manufacturer,
+			Model:        *model,
+			SerialNumber: *serialNumber,
+			Firmware:     firmwareVersion(),
+		},
+	})
+	a, as, err := timers.Accessories()
+	if err != nil {
+		log.Fatal("Failed to create accessories: ", err)
+	}
+
 	// Create the HomeKit Accessory Protocol (HAP) server
-	s, err := hap.NewServer(store, a.A)
+	s, err := hap.NewServer(store, a, as...)
 	if err != nil {
 		log.Fatal("Failed to create HAP server: ", err)
 	}
 
-	// Configure the HTTP server address
+	// Configure the HTTP server address and pairing
 	s.Addr = fmt.Sprintf(":%d", *port)
+	s.Pin = pin
+	s.SetupId = *setupID
+	printSetup(log.Writer(), a.Type, pin, *setupID, s.IsPaired())
+
+	// Serve the HTTP API on the HomeKit port, or on its own listener
+	mux := s.ServeMux()
+	var apiListener net.Listener
+	var apiHandler apiMux
+	if *apiListen != "" {
+		if apiListener, err = listenAPI(*apiListen, socketMode); err != nil {
+			log.Fatal("Failed to listen on -api-listen: ", err)
+		}
+		if useTLS {
+			cert, err := apiCertificate(*apiTLSCert, *apiTLSKey, store)
+			if err != nil {
+				log.Fatal("Failed to load the API certificate: ", err)
+			}
+			log.Printf("API certificate SHA-256 fingerprint: %s", certFingerprint(cert))
+			apiListener = tls.NewListener(apiListener, apiTLSConfig(cert))
+		}
+		apiHandler = newAPIMux()
+		mux = apiHandler
+	}
 
-	// Create a timer in stopped state (won't fire until set via HTTP API)
-	// We use time.Hour as a placeholder duration since we stop it immediately
-	t := NewSecondsTimer(time.Hour)
-	t.Stop()
+	// Persist end times on every change and re-arm countdowns that were
+	// pending when hktimer last stopped
+	timers.Restore(*missedPolicy, *graceWindow)
 
 	// Create a context for coordinating graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 
-	// Start a goroutine to wait for timer expiration and trigger the HomeKit switch
-	// This goroutine will run until shutdown and is context-aware for clean exit
+	// Start the goroutines waiting for timer expiration to trigger the HomeKit switches
+	// They run until shutdown and are context-aware for clean exit
+	timersDone := make(chan struct{})
 	go func() {
-		for {
-			select {
-			case <-t.C():
-				// Timer expired - turn on the HomeKit switch
-				log.Println("Switching on via timer")
-				a.Switch.On.SetValue(true)
-			case <-ctx.Done():
-				// Shutdown requested - clean up timer and exit goroutine
-				t.Stop()
-				log.Println("Timer goroutine stopped")
-				return
-			}
+		timers.Run(ctx)
+		close(timersDone)
+	}()
+
+	// Deliver events to the webhooks until shutdown
+	webhooksDone := make(chan struct{})
+	go func() {
+		webhooks.Run(ctx)
+		close(webhooksDone)
+	}()
+
+	// Run the exec hook on events until shutdown
+	hookDone := make(chan struct{})
+	go func() {
+		if hook != nil {
+			hook.Run(ctx)
 		}
+		close(hookDone)
 	}()
 
-	// Register the HTTP handler for the /timer endpoint
-	s.ServeMux().HandleFunc("/timer", timerHandler(t))
+	// Register the HTTP handlers for the /timers endpoints, with /timer
+	// serving the first timer, behind the client filter and the API tokens
+	api := tokens.Protect(filter.Protect(mux))
+	registerTimerSetRoutes(ctx, api, timers)
+	registerWebhookRoutes(api, webhooks)
+
+	// Register the pairing management endpoints; a reset stops hktimer
+	registerAdminRoutes(filter.Protect(mux), store, tokens, filter, cancel)
+
+	// Serve the API listener until shutdown; if it fails, stop the HAP
+	// server too
+	apiDone := make(chan struct{})
+	go func() {
+		defer close(apiDone)
+		if apiListener == nil {
+			return
+		}
+		if err := serveAPI(ctx, apiListener, apiHandler); err != nil {
+			log.Printf("API listener failed: %s", err)
+		}
+		cancel()
+	}()
 
 	// Setup signal handling for graceful shutdown
 	// Buffered channel ensures we don't miss signals during processing
@@ -114,7 +346,7 @@ func main() {
 
 		// Cancel the context, triggering graceful shutdown of:
 		// - The HAP server
-		// - The timer goroutine
+		// - The timer goroutines
 		// - Any other context-aware components
 		cancel()
 	}()
@@ -122,4 +354,43 @@ func main() {
 	// Start the server (blocks until context is cancelled)
 	log.Println("Starting hktimer")
 	s.ListenAndServe(ctx)
+
+	// Stop the API listener, timer, webhook and exec hook goroutines in case
+	// the server failed on its own, then wait for them to finish
+	cancel()
+	<-apiDone
+	<-timersDone
+	<-webhooksDone
+	<-hookDone
+}
+
+// loadTokens collects the API tokens from the flags, their environment
+// variables, the -tokens file and the -tokens-nvram variable.
+func loadTokens() (*apiTokens, error) {
+	tokens := &apiTokens{}
+	for _, t := range []struct {
+		flag  string
+		env   string
+		scope tokenScope
+	}{
+		{*readToken, "HKTIMER_READ_TOKEN", scopeRead},
+		{*controlToken, "HKTIMER_CONTROL_TOKEN", scopeControl},
+		{*adminToken, "HKTIMER_ADMIN_TOKEN", scopeAdmin},
+	} {
+		if t.flag == "" {
+			t.flag = os.Getenv(t.env)
+		}
+		tokens.Add(t.flag, t.scope)
+	}
+	if *tokensFile != "" {
+		if err := tokens.Load(*tokensFile); err != nil {
+			return nil, err
+		}
+	}
+	if *tokensNvram != "" {
+		if err := tokens.LoadNvram(*tokensNvram); err != nil {
+			return nil, err
+		}
+	}
+	return tokens, nil
 }
@@ -26,13 +26,30 @@ const nvramPrefix = "hkt_"
 // If power is lost before first pairing, non-pairing data is regenerated on
 // next startup (new uuid/keypair). Once paired, the commit includes all pending
 // changes, so keypair and pairing stay in sync.
+//
+// Keys registered with CommitOn (e.g. the armed timer) are committed as well.
+// This is opt-in because every change to them costs a flash write.
 type nvramStore struct {
-	mu sync.RWMutex
+	mu     sync.RWMutex
+	commit map[string]bool // extra keys committed to flash on change
 }
 
 // NewNvramStore creates a new NVRAM-backed store.
 func NewNvramStore() *nvramStore {
-	return &nvramStore{}
+	return &nvramStore{commit: make(map[string]bool)}
+}
+
+// CommitOn makes changes to key commit to flash, like pairing changes do.
+func (s *nvramStore) CommitOn(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commit[key] = true
+}
+
+// needsCommit reports whether a change to key must be committed to flash.
+// Callers must hold s.mu.
+func (s *nvramStore) needsCommit(key string) bool {
+	return strings.HasSuffix(key, ".pairing") || s.commit[key]
 }
 
 // nvram command wrappers - can be replaced in tests
@@ -104,7 +121,7 @@ func (s *nvramStore) Set(key string, value []byte) error {
 	}
 
 	// Only commit to flash when pairing data changes to reduce flash writes
-	if strings.HasSuffix(key, ".pairing") {
+	if s.needsCommit(key) {
 		return nvramCommit()
 	}
 	return nil
@@ -145,7 +162,7 @@ func (s *nvramStore) Delete(key string) error {
 	}
 
 	// Commit to flash when pairing data is deleted
-	if strings.HasSuffix(key, ".pairing") {
+	if s.needsCommit(key) {
 		return nvramCommit()
 	}
 	return nil
@@ -191,3 +208,10 @@ func (s *nvramStore) KeysWithSuffix(suffix string) (keys []string, err error) {
 	}
 	return
 }
+
+// nvramNTPReady reports whether the router's NTP client has synced the clock.
+// FreshTomato sets ntp_ready=1 after the first successful sync.
+func nvramNTPReady() bool {
+	value, err := nvramGet("ntp_ready")
+	return err == nil && value == "1"
+}
@@ -285,3 +285,44 @@ func TestNvramKey(t *testing.T) {
 		t.Errorf("Pairing key exceeds 64 char limit: %d chars", len(result))
 	}
 }
+
+func TestNvramStore_CommitOn(t *testing.T) {
+	mock := setupMockNvram()
+	store := NewNvramStore()
+
+	// Not committed until opted in
+	store.Set(timerStoreKey, []byte(`{"end":"2026-01-15T12:00:00Z"}`))
+	if mock.commitCount != 0 {
+		t.Errorf("Should not commit before CommitOn, got %d commits", mock.commitCount)
+	}
+
+	store.CommitOn(timerStoreKey)
+
+	store.Set(timerStoreKey, []byte(`{"end":"2026-01-15T13:00:00Z"}`))
+	if mock.commitCount != 1 {
+		t.Errorf("Expected 1 commit after Set, got %d", mock.commitCount)
+	}
+
+	store.Delete(timerStoreKey)
+	if mock.commitCount != 2 {
+		t.Errorf("Expected 2 commits after Delete, got %d", mock.commitCount)
+	}
+
+	// Other keys are unaffected
+	store.Set("uuid", []byte("AA:BB:CC:DD:EE:FF"))
+	if mock.commitCount != 2 {
+		t.Errorf("Should not commit for uuid, got %d commits", mock.commitCount)
+	}
+}
+
+func TestNvramNTPReady(t *testing.T) {
+	m := setupMockNvram()
+
+	if nvramNTPReady() {
+		t.Error("nvramNTPReady = true without ntp_ready")
+	}
+	m.data["ntp_ready"] = "1"
+	if !nvramNTPReady() {
+		t.Error("nvramNTPReady = false with ntp_ready=1")
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/service"
+
+	"time"
+)
+
+// More accessory types representing a timer in HomeKit, see accessorySwitch
+const (
+	accessoryOutlet    = "outlet"    // Outlet turned on when the timer fires
+	accessoryButton    = "button"    // Stateless programmable switch, single-pressed when the timer fires
+	accessoryContact   = "contact"   // Contact sensor that opens when the timer fires
+	accessoryMotion    = "motion"    // Motion sensor that detects motion when the timer fires
+	accessoryOccupancy = "occupancy" // Occupancy sensor that detects occupancy when the timer fires
+)
+
+// sensorPulse is how long sensors report a fire when no pulse is configured,
+// as they can't be reset from the Home app.
+const sensorPulse = 5 * time.Second
+
+// fireOutput is the part of an accessory that shows a timer firing.
+type fireOutput interface {
+	// Set shows (true) or clears (false) the fire.
+	Set(on bool)
+	// Value reports whether the fire is showing.
+	Value() bool
+	// Momentary reports whether the output has no state, like a button
+	// press, so it is never cleared.
+	Momentary() bool
+}
+
+// newFireOutput creates the accessory of type typ called name, and its output.
+// typ must not be accessoryValve.
+func newFireOutput(typ, name string) (*accessory.A, fireOutput) {
+	info := accessory.Info{
+		Name: name,
+	}
+
+	switch typ {
+	case accessoryOutlet:
+		a := accessory.NewOutlet(info)
+		return a.A, onOutput{a.Outlet.On}
+	case accessoryButton:
+		a := accessory.New(info, accessory.TypeProgrammableSwitch)
+		s := service.NewStatelessProgrammableSwitch()
+		a.AddS(s.S)
+		return a, buttonOutput{s.ProgrammableSwitchEvent}
+	case accessoryContact:
+		a := accessory.NewContactSensor(info)
+		state := a.ContactSensor.ContactSensorState
+		return a.A, intOutput{state.Int, characteristic.ContactSensorStateContactNotDetected, characteristic.ContactSensorStateContactDetected}
+	case accessoryMotion:
+		a := accessory.NewMotionSensor(info)
+		return a.A, boolOutput{a.MotionSensor.MotionDetected.Bool}
+	case accessoryOccupancy:
+		a := accessory.New(info, accessory.TypeSensor)
+		s := service.NewOccupancySensor()
+		a.AddS(s.S)
+		return a, intOutput{s.OccupancyDetected.Int, characteristic.OccupancyDetectedOccupancyDetected, characteristic.OccupancyDetectedOccupancyNotDetected}
+	default:
+		a := accessory.NewSwitch(info)
+		return a.A, onOutput{a.Switch.On}
+	}
+}
+
+// onOutput is the On characteristic of a switch or outlet, which users can
+// also turn on and off in the Home app.
+type onOutput struct {
+	On *characteristic.On
+}
+
+func (o onOutput) Set(on bool)     { o.On.SetValue(on) }
+func (o onOutput) Value() bool     { return o.On.Value() }
+func (o onOutput) Momentary() bool { return false }
+
+// boolOutput is a read-only sensor characteristic that is true while firing.
+type boolOutput struct {
+	c *characteristic.Bool
+}
+
+func (o boolOutput) Set(on bool)     { o.c.SetValue(on) }
+func (o boolOutput) Value() bool     { return o.c.Value() }
+func (o boolOutput) Momentary() bool { return false }
+
+// intOutput is a read-only sensor characteristic with distinct values for
+// firing (on) and not firing (off).
+type intOutput struct {
+	c       *characteristic.Int
+	on, off int
+}
+
+func (o intOutput) Set(on bool) {
+	if on {
+		o.c.SetValue(o.on)
+	} else {
+		o.c.SetValue(o.off)
+	}
+}
+func (o intOutput) Value() bool     { return o.c.Value() == o.on }
+func (o intOutput) Momentary() bool { return false }
+
+// buttonOutput is a stateless programmable switch, single-pressed on every fire.
+type buttonOutput struct {
+	event *characteristic.ProgrammableSwitchEvent
+}
+
+func (o buttonOutput) Set(on bool) {
+	if on {
+		o.event.SetValue(characteristic.ProgrammableSwitchEventSinglePress)
+	}
+}
+func (o buttonOutput) Value() bool     { return false }
+func (o buttonOutput) Momentary() bool { return true }
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"github.com/brutella/hap"
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/service"
+
+	"net/http"
+	"testing"
+)
+
+// TestFireOutputAccessories verifies each accessory type gets the matching service
+func TestFireOutputAccessories(t *testing.T) {
+	testCases := []struct {
+		typ     string
+		service string
+		on      bool
+	}{
+		{accessorySwitch, service.TypeSwitch, true},
+		{accessoryOutlet, service.TypeOutlet, true},
+		{accessoryButton, service.TypeStatelessProgrammableSwitch, false},
+		{accessoryContact, service.TypeContactSensor, false},
+		{accessoryMotion, service.TypeMotionSensor, false},
+		{accessoryOccupancy, service.TypeOccupancySensor, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.typ, func(t *testing.T) {
+			nt := newNamedTimer(defaultTimerName, hap.NewMemStore(), timerConfig{Accessory: tc.typ})
+
+			found := false
+			for _, s := range nt.A.Ss {
+				if s.Type == tc.service {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("Accessory has no service of type %s", tc.service)
+			}
+			if (nt.On != nil) != tc.on {
+				t.Errorf("On characteristic present = %v, expected %v", nt.On != nil, tc.on)
+			}
+		})
+	}
+}
+
+// TestFireOutputSensors verifies sensors report a fire and reset after sensorPulse
+func TestFireOutputSensors(t *testing.T) {
+	for _, typ := range []string{accessoryContact, accessoryMotion, accessoryOccupancy} {
+		t.Run(typ, func(t *testing.T) {
+			clock := newFakeClock(testEpoch)
+			nt := newNamedTimer(defaultTimerName, hap.NewMemStore(), timerConfig{Accessory: typ, Clock: clock})
+			if nt.Latched() {
+				t.Fatal("Sensor reports a fire before firing")
+			}
+
+			nt.switchOn("timer")
+			if !nt.Latched() {
+				t.Fatal("Sensor doesn't report the fire")
+			}
+
+			clock.Advance(sensorPulse)
+			if nt.Latched() {
+				t.Error("Sensor still reports the fire after sensorPulse")
+			}
+		})
+	}
+}
+
+// TestFireOutputContactState verifies the contact sensor opens on a fire
+func TestFireOutputContactState(t *testing.T) {
+	nt := newNamedTimer(defaultTimerName, hap.NewMemStore(), timerConfig{Accessory: accessoryContact, Clock: newFakeClock(testEpoch)})
+	state := nt.Output.(intOutput).c
+
+	if v := state.Value(); v != characteristic.ContactSensorStateContactDetected {
+		t.Errorf("Contact state before firing = %d, expected closed", v)
+	}
+	nt.switchOn("timer")
+	if v := state.Value(); v != characteristic.ContactSensorStateContactNotDetected {
+		t.Errorf("Contact state after firing = %d, expected open", v)
+	}
+}
+
+// TestFireOutputButton verifies the button sends a single press on every fire
+func TestFireOutputButton(t *testing.T) {
+	clock := newFakeClock(testEpoch)
+	nt := newNamedTimer(defaultTimerName, hap.NewMemStore(), timerConfig{Accessory: accessoryButton, Clock: clock})
+
+	presses := 0
+	nt.Output.(buttonOutput).event.OnValueUpdate(func(new, old int, req *http.Request) {
+		if new == characteristic.ProgrammableSwitchEventSinglePress {
+			presses++
+		}
+	})
+
+	nt.switchOn("timer")
+	nt.switchOn("schedule")
+	if presses != 2 {
+		t.Errorf("Single presses = %d, expected 2", presses)
+	}
+	if nt.Latched() {
+		t.Error("Button reported as latched")
+	}
+	if clock.Pending() != 0 {
+		t.Error("Button scheduled a pulse")
+	}
+}
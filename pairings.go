@@ -0,0 +1,163 @@
+package main
+
+import (
+	"github.com/brutella/hap"
+
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// pairingSuffix is the hap.Store key suffix of pairings; the key is the
+// hex-encoded controller id followed by the suffix.
+const pairingSuffix = ".pairing"
+
+// hapIdentityKeys are the hap.Store keys making up the accessory's HAP
+// identity, besides the pairings. hap regenerates them on the next start.
+var hapIdentityKeys = []string{"uuid", "keypair", "version", "configHash"}
+
+// outputPairing represents one pairing in the JSON response for GET /admin/pairings.
+type outputPairing struct {
+	ID    string `json:"id"`    // Controller id, used to remove the pairing
+	Admin bool   `json:"admin"` // Whether the controller may manage pairings
+}
+
+// pairingKey returns the hap.Store key of the pairing with controller id.
+func pairingKey(id string) string {
+	return hex.EncodeToString([]byte(id)) + pairingSuffix
+}
+
+// listPairings returns the pairings in store, sorted by controller id.
+func listPairings(store hap.Store) ([]outputPairing, error) {
+	keys, err := store.KeysWithSuffix(pairingSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	pairings := make([]outputPairing, 0, len(keys))
+	for _, key := range keys {
+		b, err := store.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		var p hap.Pairing
+		if err := json.Unmarshal(b, &p); err != nil {
+			return nil, err
+		}
+		pairings = append(pairings, outputPairing{ID: p.Name, Admin: p.Permission == hap.PermissionAdmin})
+	}
+	sort.Slice(pairings, func(i, j int) bool { return pairings[i].ID < pairings[j].ID })
+	return pairings, nil
+}
+
+// resetPairings deletes the pairings and the HAP identity from store. The
+// identity goes first, so with nvramStore the commit of the pairing deletions
+// also commits the identity; without pairings nothing is committed, as
+// nothing needs to be.
+func resetPairings(store hap.Store) error {
+	for _, key := range hapIdentityKeys {
+		// Keys may be missing, e.g. configHash before the first start
+		if _, err := store.Get(key); err != nil {
+			continue
+		}
+		if err := store.Delete(key); err != nil {
+			return err
+		}
+	}
+
+	keys, err := store.KeysWithSuffix(pairingSuffix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := store.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// registerAdminRoutes registers the pairing management handlers, which
+// require an admin token:
+//   - /admin/pairings: GET lists the pairings
+//   - /admin/pairings/{id}: DELETE removes a pairing
+//   - /admin/reset: POST removes all pairings and the HAP identity, then
+//     calls shutdown, as the running server still uses the old identity
+//   - /admin/filter: GET reports the requests rejected by filter
+func registerAdminRoutes(mux hap.ServeMux, store hap.Store, tokens *apiTokens, filter *ipFilter, shutdown func()) {
+	pairings := tokens.Require(scopeAdmin, pairingsHandler(store, "/admin/pairings"))
+	mux.HandleFunc("/admin/pairings", pairings)
+	mux.HandleFunc("/admin/pairings/*", pairings)
+	mux.HandleFunc("/admin/reset", tokens.Require(scopeAdmin, resetHandler(store, shutdown)))
+	mux.HandleFunc("/admin/filter", tokens.Require(scopeAdmin, filterHandler(filter)))
+}
+
+// pairingsHandler serves the pairings in store below path.
+func pairingsHandler(store hap.Store, path string) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		id := strings.TrimPrefix(strings.TrimPrefix(req.URL.Path, path), "/")
+
+		switch {
+		case req.Method == http.MethodGet && id == "":
+			pairings, err := listPairings(store)
+			if err != nil {
+				log.Printf("GET pairings request failed: %s", err)
+				http.Error(res, "Unable to read pairings", http.StatusInternalServerError)
+				return
+			}
+			res.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(res).Encode(pairings)
+
+		case req.Method == http.MethodDelete && id != "":
+			log.Printf("DELETE pairing %s request from %s", id, req.Header.Get("User-Agent"))
+
+			key := pairingKey(id)
+			if _, err := store.Get(key); err != nil {
+				http.Error(res, "Pairing not found", http.StatusNotFound)
+				return
+			}
+			if err := store.Delete(key); err != nil {
+				log.Printf("DELETE pairing request failed: %s", err)
+				http.Error(res, "Unable to remove pairing", http.StatusInternalServerError)
+				return
+			}
+			log.Printf("Removed pairing %s", id)
+
+			res.Header().Set("Content-Type", "application/json")
+			res.Write([]byte(`{"success":true}`))
+
+		default:
+			log.Printf("HTTP request not supported")
+			http.Error(res, "Not supported", http.StatusNotImplemented)
+		}
+	}
+}
+
+// resetHandler removes all pairings and the HAP identity from store, then
+// calls shutdown.
+func resetHandler(store hap.Store, shutdown func()) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			log.Printf("HTTP request not supported")
+			http.Error(res, "Not supported", http.StatusNotImplemented)
+			return
+		}
+		log.Printf("POST reset request from %s", req.Header.Get("User-Agent"))
+
+		if err := resetPairings(store); err != nil {
+			log.Printf("POST reset request failed: %s", err)
+			http.Error(res, "Unable to reset pairings", http.StatusInternalServerError)
+			return
+		}
+		log.Println("Removed all pairings and the HAP identity, stopping hktimer")
+
+		// Send the response before the server closes its connections
+		res.Header().Set("Content-Type", "application/json")
+		res.Write([]byte(`{"success":true}`))
+		http.NewResponseController(res).Flush()
+		shutdown()
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"github.com/brutella/hap"
+
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newPairedStore returns a store with an identity and two pairings
+func newPairedStore(t *testing.T, store hap.Store) hap.Store {
+	t.Helper()
+	for _, p := range []hap.Pairing{
+		{Name: "B2A4F1C0-0000-4000-8000-000000000002", Permission: hap.PermissionUser},
+		{Name: "A1C3E5D0-0000-4000-8000-000000000001", Permission: hap.PermissionAdmin},
+	} {
+		b, _ := json.Marshal(p)
+		if err := store.Set(pairingKey(p.Name), b); err != nil {
+			t.Fatalf("Set pairing failed: %v", err)
+		}
+	}
+	store.Set("uuid", []byte("AA:BB:CC:DD:EE:FF"))
+	store.Set("keypair", []byte(`{"Public":"","Private":""}`))
+	return store
+}
+
+// TestPairingsHandlerList verifies pairings are listed with their admin flag
+func TestPairingsHandlerList(t *testing.T) {
+	store := newPairedStore(t, hap.NewMemStore())
+	rec := httptest.NewRecorder()
+	pairingsHandler(store, "/admin/pairings")(rec, httptest.NewRequest(http.MethodGet, "/admin/pairings", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET returned status %d, expected %d", rec.Code, http.StatusOK)
+	}
+	var pairings []outputPairing
+	if err := json.Unmarshal(rec.Body.Bytes(), &pairings); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+	expected := []outputPairing{
+		{ID: "A1C3E5D0-0000-4000-8000-000000000001", Admin: true},
+		{ID: "B2A4F1C0-0000-4000-8000-000000000002", Admin: false},
+	}
+	if len(pairings) != len(expected) || pairings[0] != expected[0] || pairings[1] != expected[1] {
+		t.Errorf("Pairings = %v, expected %v", pairings, expected)
+	}
+
+	// An unpaired accessory lists no pairings rather than null
+	rec = httptest.NewRecorder()
+	pairingsHandler(hap.NewMemStore(), "/admin/pairings")(rec, httptest.NewRequest(http.MethodGet, "/admin/pairings", nil))
+	if body := rec.Body.String(); body != "[]\n" {
+		t.Errorf("Body without pairings = %q, expected []", body)
+	}
+}
+
+// TestPairingsHandlerDelete verifies one pairing is removed and unknown ones are reported
+func TestPairingsHandlerDelete(t *testing.T) {
+	store := newPairedStore(t, hap.NewMemStore())
+	handler := pairingsHandler(store, "/admin/pairings")
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodDelete, "/admin/pairings/B2A4F1C0-0000-4000-8000-000000000002", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("DELETE returned status %d, expected %d", rec.Code, http.StatusOK)
+	}
+	if pairings, _ := listPairings(store); len(pairings) != 1 || pairings[0].ID != "A1C3E5D0-0000-4000-8000-000000000001" {
+		t.Errorf("Pairings after DELETE = %v, expected only the admin", pairings)
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodDelete, "/admin/pairings/unknown", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("DELETE of unknown pairing returned status %d, expected %d", rec.Code, http.StatusNotFound)
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodDelete, "/admin/pairings", nil))
+	if rec.Code != http.StatusNotImplemented {
+		t.Errorf("DELETE without id returned status %d, expected %d", rec.Code, http.StatusNotImplemented)
+	}
+}
+
+// TestResetHandler verifies a reset removes pairings and identity, then shuts down
+func TestResetHandler(t *testing.T) {
+	store := newPairedStore(t, hap.NewMemStore())
+	store.Set(timerStoreKey, []byte(`{}`))
+	stopped := false
+	handler := resetHandler(store, func() { stopped = true })
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/admin/reset", nil))
+	if rec.Code != http.StatusNotImplemented || stopped {
+		t.Errorf("GET returned status %d, expected %d without shutdown", rec.Code, http.StatusNotImplemented)
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/admin/reset", nil))
+	if rec.Code != http.StatusOK || !stopped {
+		t.Errorf("POST returned status %d with shutdown %v, expected %d with shutdown", rec.Code, stopped, http.StatusOK)
+	}
+	if keys, _ := store.KeysWithSuffix(pairingSuffix); len(keys) != 0 {
+		t.Errorf("Pairings left after reset: %v", keys)
+	}
+	for _, key := range []string{"uuid", "keypair"} {
+		if _, err := store.Get(key); err == nil {
+			t.Errorf("Key %s left after reset", key)
+		}
+	}
+	if _, err := store.Get(timerStoreKey); err != nil {
+		t.Error("Reset removed the persisted timer")
+	}
+}
+
+// TestResetPairingsNvramCommit verifies an NVRAM reset is committed through the pairing deletions
+func TestResetPairingsNvramCommit(t *testing.T) {
+	m := setupMockNvram()
+	store := newPairedStore(t, NewNvramStore())
+	m.commitCount = 0
+
+	if err := resetPairings(store); err != nil {
+		t.Fatalf("resetPairings failed: %v", err)
+	}
+	if m.commitCount != 2 {
+		t.Errorf("Commits = %d, expected one per pairing", m.commitCount)
+	}
+	for _, key := range []string{"hkt_uuid", "hkt_keypair"} {
+		if _, ok := m.data[key]; ok {
+			t.Errorf("NVRAM variable %s left after reset", key)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"github.com/brutella/hap"
+
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Pairing event types
+const (
+	pairingPaired   = "paired"   // A controller was paired
+	pairingUnpaired = "unpaired" // A controller's pairing was removed
+)
+
+// securityLog logs pairing changes with a distinct prefix, so they stand out
+// from regular timer logs and can be filtered for.
+var securityLog = log.New(log.Writer(), "SECURITY: ", log.LstdFlags|log.Lmsgprefix)
+
+// pairingEvent reports a controller pairing or unpairing.
+type pairingEvent struct {
+	Type  string    // pairingPaired or pairingUnpaired
+	ID    string    // Controller id
+	Admin bool      // Whether the controller may manage pairings; false for unpaired
+	Time  time.Time // When the change was stored
+}
+
+// pairingStore is a hap.Store decorator reporting pairings being added and
+// removed. hap stores each pairing under a key ending in pairingSuffix, so any
+// backend works.
+type pairingStore struct {
+	hap.Store
+
+	mu       sync.Mutex // serialises pairing changes so events match the store
+	onChange []func(event pairingEvent)
+}
+
+// newPairingStore wraps store.
+func newPairingStore(store hap.Store) *pairingStore {
+	return &pairingStore{Store: store}
+}
+
+// OnChange registers fn to be called after a pairing was added or removed.
+// Callbacks run synchronously in the order of the changes; register them
+// before the store is used.
+func (s *pairingStore) OnChange(fn func(event pairingEvent)) {
+	s.onChange = append(s.onChange, fn)
+}
+
+// Set stores the key-value pair and reports a new pairing.
+func (s *pairingStore) Set(key string, value []byte) error {
+	if !strings.HasSuffix(key, pairingSuffix) {
+		return s.Store.Set(key, value)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.Store.Get(key)
+	existed := err == nil
+	if err := s.Store.Set(key, value); err != nil {
+		return err
+	}
+	if existed {
+		// Permission change of an existing pairing
+		return nil
+	}
+
+	var p hap.Pairing
+	if err := json.Unmarshal(value, &p); err != nil {
+		// Stored as given, but there is no pairing to report
+		log.Printf("Failed to decode pairing %s: %s", pairingID(key), err)
+		return nil
+	}
+	s.emit(pairingEvent{Type: pairingPaired, ID: pairingID(key), Admin: p.Permission == hap.PermissionAdmin})
+	return nil
+}
+
+// Delete removes the key and reports a removed pairing.
+func (s *pairingStore) Delete(key string) error {
+	if !strings.HasSuffix(key, pairingSuffix) {
+		return s.Store.Delete(key)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.Store.Get(key)
+	existed := err == nil
+	if err := s.Store.Delete(key); err != nil {
+		return err
+	}
+	if existed {
+		s.emit(pairingEvent{Type: pairingUnpaired, ID: pairingID(key)})
+	}
+	return nil
+}
+
+// emit logs event and runs the OnChange callbacks. Callers must hold s.mu.
+func (s *pairingStore) emit(event pairingEvent) {
+	event.Time = time.Now()
+	if event.Admin {
+		securityLog.Printf("Controller %s %s as admin", event.ID, event.Type)
+	} else {
+		securityLog.Printf("Controller %s %s", event.ID, event.Type)
+	}
+	for _, fn := range s.onChange {
+		fn(event)
+	}
+}
+
+// pairingID returns the controller id of a pairing key, see pairingKey.
+func pairingID(key string) string {
+	hexID := strings.TrimSuffix(key, pairingSuffix)
+	id, err := hex.DecodeString(hexID)
+	if err != nil {
+		return hexID
+	}
+	return string(id)
+}
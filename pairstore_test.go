@@ -0,0 +1,79 @@
+package main
+
+import (
+	"github.com/brutella/hap"
+
+	"encoding/json"
+	"testing"
+)
+
+// TestPairingStoreEvents verifies pairing changes are reported once with the controller id
+func TestPairingStoreEvents(t *testing.T) {
+	store := newPairingStore(hap.NewMemStore())
+	var events []pairingEvent
+	store.OnChange(func(event pairingEvent) {
+		events = append(events, event)
+	})
+
+	id := "A1C3E5D0-0000-4000-8000-000000000001"
+	admin, _ := json.Marshal(hap.Pairing{Name: id, Permission: hap.PermissionAdmin})
+	user, _ := json.Marshal(hap.Pairing{Name: id, Permission: hap.PermissionUser})
+
+	store.Set(pairingKey(id), admin)
+	store.Set(pairingKey(id), user) // permission change, not a new pairing
+	store.Delete(pairingKey(id))
+	store.Delete(pairingKey(id)) // already removed
+	store.Set("uuid", []byte("AA:BB:CC:DD:EE:FF"))
+	store.Delete("uuid")
+
+	if len(events) != 2 {
+		t.Fatalf("Events = %v, expected paired and unpaired", events)
+	}
+	if e := events[0]; e.Type != pairingPaired || e.ID != id || !e.Admin || e.Time.IsZero() {
+		t.Errorf("First event = %+v, expected %s admin %s", e, pairingPaired, id)
+	}
+	if e := events[1]; e.Type != pairingUnpaired || e.ID != id || e.Admin {
+		t.Errorf("Second event = %+v, expected %s %s", e, pairingUnpaired, id)
+	}
+}
+
+// TestPairingStoreMalformed verifies undecodable pairings are stored but not reported
+func TestPairingStoreMalformed(t *testing.T) {
+	store := newPairingStore(hap.NewMemStore())
+	var events []pairingEvent
+	store.OnChange(func(event pairingEvent) {
+		events = append(events, event)
+	})
+
+	key := pairingKey("C3B5A2D0-0000-4000-8000-000000000003")
+	if err := store.Set(key, []byte("not json")); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, err := store.Get(key); err != nil {
+		t.Errorf("Malformed pairing not stored: %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("Events = %v, expected none", events)
+	}
+}
+
+// TestPairingStorePassThrough verifies the decorated store keeps working
+func TestPairingStorePassThrough(t *testing.T) {
+	m := setupMockNvram()
+	store := newPairingStore(NewNvramStore())
+
+	id := "B2A4F1C0-0000-4000-8000-000000000002"
+	b, _ := json.Marshal(hap.Pairing{Name: id})
+	if err := store.Set(pairingKey(id), b); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if m.commitCount != 1 {
+		t.Errorf("Commits = %d, expected 1", m.commitCount)
+	}
+	if keys, _ := store.KeysWithSuffix(pairingSuffix); len(keys) != 1 || keys[0] != pairingKey(id) {
+		t.Errorf("KeysWithSuffix = %v, expected the pairing", keys)
+	}
+	if pairingID(pairingKey(id)) != id {
+		t.Errorf("pairingID = %q, expected %q", pairingID(pairingKey(id)), id)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"github.com/brutella/hap"
+
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// timerStoreKey is the hap.Store key holding the armed timer.
+// With NVRAM storage it becomes the "hkt_timer" variable.
+const timerStoreKey = "timer"
+
+// Policies for deadlines that passed while hktimer was not running
+const (
+	missedFire  = "fire"  // Fire immediately on startup
+	missedSkip  = "skip"  // Discard the missed deadline
+	missedGrace = "grace" // Fire only if the deadline passed within the grace window
+)
+
+// persistedTimer is the JSON document stored under timerStoreKey.
+type persistedTimer struct {
+	End      time.Time     `json:"end"`                // When the armed timer fires
+	Absolute bool          `json:"absolute,omitempty"` // End was requested as a wall-clock time, see SecondsTimer.ResetAt
+	Paused   time.Duration `json:"paused,omitempty"`   // Remaining time of a paused timer
+}
+
+// timerPersister saves the armed end time in a hap.Store so a countdown
+// survives restarts and router reboots.
+//
+// It writes through the same store the HAP server uses, so with NVRAM storage
+// the end time lives in NVRAM RAM and is only committed to flash if the key
+// was registered with nvramStore.CommitOn.
+type timerPersister struct {
+	store hap.Store
+	key   string
+}
+
+// newTimerPersister creates a persister storing the end time under key.
+func newTimerPersister(store hap.Store, key string) *timerPersister {
+	return &timerPersister{store: store, key: key}
+}
+
+// Save stores the end time of an armed timer or the remaining time of a paused one.
+func (p *timerPersister) Save(status TimerStatus) error {
+	data, err := json.Marshal(persistedTimer{End: status.End, Absolute: status.Absolute, Paused: status.Paused})
+	if err != nil {
+		return err
+	}
+	return p.store.Set(p.key, data)
+}
+
+// Clear removes the stored end time, if any.
+func (p *timerPersister) Clear() error {
+	// Stores differ in how they report deleting a missing key, so check first
+	if _, err := p.store.Get(p.key); err != nil {
+		return nil
+	}
+	return p.store.Delete(p.key)
+}
+
+// Load returns the stored timer. The boolean is false if nothing is stored.
+func (p *timerPersister) Load() (persistedTimer, bool, error) {
+	var pt persistedTimer
+	data, err := p.store.Get(p.key)
+	if err != nil || len(data) == 0 {
+		// Stores report missing keys as errors
+		return pt, false, nil
+	}
+
+	if err := json.Unmarshal(data, &pt); err != nil {
+		return pt, false, fmt.Errorf("decode %s: %w", p.key, err)
+	}
+	return pt, true, nil
+}
+
+// Track saves the timer whenever t is armed or paused and clears it when t
+// fires or is cancelled. OnChange callbacks run in transition order, so a
+// countdown armed right after a fire is never cleared by it.
+func (p *timerPersister) Track(t *SecondsTimer) {
+	t.OnChange(func(status TimerStatus) {
+		var err error
+		switch status.State {
+		case StateArmed, StatePaused:
+			err = p.Save(status)
+		case StateFired, StateCancelled:
+			err = p.Clear()
+		}
+		if err != nil {
+			log.Printf("Failed to persist timer: %s", err)
+		}
+	})
+}
+
+// validMissedPolicy reports whether policy is a known missed-deadline policy.
+func validMissedPolicy(policy string) bool {
+	switch policy {
+	case missedFire, missedSkip, missedGrace:
+		return true
+	}
+	return false
+}
+
+// restoreTimer re-arms t from the persisted end time.
+// Deadlines that passed while hktimer was not running are handled according
+// to policy; grace is only used by missedGrace.
+func restoreTimer(timer *SecondsTimer, p *timerPersister, policy string, grace time.Duration) error {
+	t := timer.Via(sourceRestore)
+	pt, ok, err := p.Load()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+
+	if pt.End.IsZero() {
+		// Paused timers do not run down while hktimer is stopped
+		log.Printf("Restoring paused timer, %d seconds remaining", int(pt.Paused.Round(time.Second).Seconds()))
+		t.ResetPaused(pt.Paused)
+		return nil
+	}
+
+	remaining := pt.End.Sub(t.Now())
+	if remaining > 0 {
+		log.Printf("Restoring timer, %d seconds remaining", int(remaining.Round(time.Second).Seconds()))
+		if pt.Absolute {
+			// Keep the requested wall-clock time across clock steps, as ResetAt did
+			t.ResetAt(pt.End)
+		} else {
+			t.Reset(remaining)
+		}
+		return nil
+	}
+
+	overdue := -remaining
+	switch {
+	case policy == missedFire, policy == missedGrace && overdue <= grace:
+		log.Printf("Timer deadline missed by %s, firing now", overdue.Round(time.Second))
+		t.Reset(0)
+		return nil
+	default:
+		log.Printf("Timer deadline missed by %s, skipping", overdue.Round(time.Second))
+		return p.Clear()
+	}
+}
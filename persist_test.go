@@ -0,0 +1,220 @@
+package main
+
+import (
+	"github.com/brutella/hap"
+
+	"testing"
+	"time"
+)
+
+// TestPersisterSaveLoad verifies the end time round-trips through the store
+func TestPersisterSaveLoad(t *testing.T) {
+	p := newTimerPersister(hap.NewMemStore(), timerStoreKey)
+
+	end := time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)
+	if err := p.Save(TimerStatus{State: StateArmed, End: end}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded, ok, err := p.Load()
+	if err != nil || !ok {
+		t.Fatalf("Load = %v, %v, %v; expected stored end time", loaded, ok, err)
+	}
+	if !loaded.End.Equal(end) {
+		t.Errorf("Loaded end = %v, expected %v", loaded.End, end)
+	}
+}
+
+// TestPersisterClear verifies Clear removes the end time and tolerates an empty store
+func TestPersisterClear(t *testing.T) {
+	p := newTimerPersister(hap.NewMemStore(), timerStoreKey)
+
+	if err := p.Clear(); err != nil {
+		t.Errorf("Clear on empty store failed: %v", err)
+	}
+
+	p.Save(TimerStatus{State: StateArmed, End: time.Now()})
+	if err := p.Clear(); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+
+	if _, ok, _ := p.Load(); ok {
+		t.Error("Load found an end time after Clear")
+	}
+}
+
+// TestPersisterLoadCorrupt verifies a corrupt document is reported as an error
+func TestPersisterLoadCorrupt(t *testing.T) {
+	store := hap.NewMemStore()
+	store.Set(timerStoreKey, []byte("not json"))
+	p := newTimerPersister(store, timerStoreKey)
+
+	if _, _, err := p.Load(); err == nil {
+		t.Error("Expected error for corrupt document")
+	}
+}
+
+// TestPersisterTrack verifies every Reset is persisted
+func TestPersisterTrack(t *testing.T) {
+	p := newTimerPersister(hap.NewMemStore(), timerStoreKey)
+	timer := NewIdleTimer()
+	p.Track(timer)
+
+	timer.Reset(time.Minute)
+
+	pt, ok, err := p.Load()
+	if err != nil || !ok {
+		t.Fatalf("Load = %v, %v, %v; expected stored end time", pt, ok, err)
+	}
+	if !pt.End.Equal(timer.End()) {
+		t.Errorf("Persisted end = %v, expected %v", pt.End, timer.End())
+	}
+
+	// Pausing stores the remaining time instead of the end time
+	timer.Pause()
+	pt, _, _ = p.Load()
+	if !pt.End.IsZero() || pt.Paused != timer.Status().Paused {
+		t.Errorf("Persisted paused timer = %+v, expected remaining %v", pt, timer.Status().Paused)
+	}
+
+	// Cancelling clears the persisted end time
+	timer.Stop()
+	if _, ok, _ := p.Load(); ok {
+		t.Error("Persisted end time present after Stop")
+	}
+
+	// Firing clears it too, while a countdown armed right after is kept
+	timer.Reset(time.Minute)
+	timer.Fire()
+	if _, ok, _ := p.Load(); ok {
+		t.Error("Persisted end time present after Fire")
+	}
+	timer.Reset(time.Minute)
+	if _, ok, _ := p.Load(); !ok {
+		t.Error("Countdown armed after Fire not persisted")
+	}
+	timer.Stop()
+}
+
+// TestRestoreTimerPending verifies a pending countdown is re-armed
+func TestRestoreTimerPending(t *testing.T) {
+	p := newTimerPersister(hap.NewMemStore(), timerStoreKey)
+	p.Save(TimerStatus{State: StateArmed, End: time.Now().Add(time.Minute)})
+
+	timer := NewIdleTimer()
+	defer timer.Stop()
+
+	if err := restoreTimer(timer, p, missedSkip, 0); err != nil {
+		t.Fatalf("restoreTimer failed: %v", err)
+	}
+
+	remaining := timer.TimeRemaining()
+	if remaining < 59*time.Second || remaining > time.Minute {
+		t.Errorf("TimeRemaining = %v, expected ~1m", remaining)
+	}
+}
+
+// TestRestoreTimerAbsolute verifies a countdown to a wall-clock time is
+// restored for that time, in the requested zone
+func TestRestoreTimerAbsolute(t *testing.T) {
+	p := newTimerPersister(hap.NewMemStore(), timerStoreKey)
+	clock := newFakeClock(testEpoch)
+	timer := NewIdleTimerWithClock(clock)
+	p.Track(timer)
+	end := testEpoch.Add(time.Hour).In(time.FixedZone("", 2*60*60))
+	timer.ResetAt(end)
+
+	restored := NewIdleTimerWithClock(clock)
+	if err := restoreTimer(restored, p, missedSkip, 0); err != nil {
+		t.Fatalf("restoreTimer failed: %v", err)
+	}
+	st := restored.Status()
+	if !st.Absolute || !st.End.Equal(end) {
+		t.Fatalf("Restored status = %+v, expected absolute end %v", st, end)
+	}
+	if _, offset := st.End.Zone(); offset != 2*60*60 {
+		t.Errorf("Restored end %v not in the requested zone", st.End)
+	}
+
+	// The end stays at the wall-clock time when the clock steps
+	clock.Step(time.Minute)
+	restored.Resync()
+	if !restored.End().Equal(end) {
+		t.Errorf("End after step = %v, expected %v", restored.End(), end)
+	}
+}
+
+// TestRestoreTimerPaused verifies a paused countdown is restored paused
+func TestRestoreTimerPaused(t *testing.T) {
+	p := newTimerPersister(hap.NewMemStore(), timerStoreKey)
+	p.Save(TimerStatus{State: StatePaused, Paused: time.Minute})
+
+	timer := NewIdleTimer()
+	defer timer.Stop()
+
+	if err := restoreTimer(timer, p, missedFire, 0); err != nil {
+		t.Fatalf("restoreTimer failed: %v", err)
+	}
+
+	st := timer.Status()
+	if st.State != StatePaused || st.Paused != time.Minute {
+		t.Errorf("Restored status = %+v, expected paused with 1m remaining", st)
+	}
+}
+
+// TestRestoreTimerMissed verifies each policy for a deadline that passed while stopped
+func TestRestoreTimerMissed(t *testing.T) {
+	testCases := []struct {
+		name    string
+		policy  string
+		grace   time.Duration
+		overdue time.Duration
+		fires   bool
+	}{
+		{"Fire", missedFire, 0, time.Hour, true},
+		{"Skip", missedSkip, 0, time.Second, false},
+		{"Within grace", missedGrace, time.Minute, time.Second, true},
+		{"Outside grace", missedGrace, time.Minute, time.Hour, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := newTimerPersister(hap.NewMemStore(), timerStoreKey)
+			p.Save(TimerStatus{State: StateArmed, End: time.Now().Add(-tc.overdue)})
+
+			timer := NewIdleTimer()
+			defer timer.Stop()
+
+			if err := restoreTimer(timer, p, tc.policy, tc.grace); err != nil {
+				t.Fatalf("restoreTimer failed: %v", err)
+			}
+
+			select {
+			case <-timer.C():
+				if !tc.fires {
+					t.Error("Timer fired, expected missed deadline to be skipped")
+				}
+			case <-time.After(100 * time.Millisecond):
+				if tc.fires {
+					t.Error("Timer did not fire for missed deadline")
+				}
+			}
+
+			if _, ok, _ := p.Load(); ok == !tc.fires {
+				t.Errorf("Persisted end time present = %v, expected %v", ok, tc.fires)
+			}
+		})
+	}
+}
+
+// TestValidMissedPolicy verifies policy name validation
+func TestValidMissedPolicy(t *testing.T) {
+	for _, policy := range []string{missedFire, missedSkip, missedGrace} {
+		if !validMissedPolicy(policy) {
+			t.Errorf("validMissedPolicy(%q) = false, expected true", policy)
+		}
+	}
+	if validMissedPolicy("later") {
+		t.Error("validMissedPolicy(\"later\") = true, expected false")
+	}
+}
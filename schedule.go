@@ -0,0 +1,234 @@
+package main
+
+import (
+	"github.com/brutella/hap"
+
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// schedulesStoreKey is the hap.Store key holding the schedules of the default timer.
+// With NVRAM storage it becomes the "hkt_schedules" variable.
+const schedulesStoreKey = "schedules"
+
+// maxSchedules limits the schedules per timer, as NVRAM variables are small.
+const maxSchedules = 16
+
+// ErrTooManySchedules is returned when adding a schedule beyond maxSchedules.
+var ErrTooManySchedules = fmt.Errorf("at most %d schedules per timer", maxSchedules)
+
+// schedule is a recurring fire time defined by a cron expression.
+type schedule struct {
+	ID   string `json:"id"`   // Random identifier, used to delete the schedule
+	Cron string `json:"cron"` // Cron expression as given
+	expr *cronExpr
+}
+
+// scheduler fires a timer's switch on recurring schedules, independently of
+// the one-shot countdown. Schedules are saved in a hap.Store so they survive
+// restarts.
+type scheduler struct {
+	store hap.Store
+	key   string
+	loc   *time.Location // time zone the cron expressions are evaluated in
+	sync  *clockSync     // schedules only run while the wall clock is synced
+	clock Clock
+	fire  func() // called when a schedule is due
+
+	mu        sync.Mutex
+	schedules []*schedule
+	changed   chan struct{} // wakes Run when schedules change
+}
+
+// newScheduler creates a scheduler storing its schedules under key and calling
+// fire when one is due according to the clock of sync. loc is the time zone of
+// the cron expressions; nil means time.Local.
+func newScheduler(store hap.Store, key string, loc *time.Location, sync *clockSync, fire func()) *scheduler {
+	if loc == nil {
+		loc = time.Local
+	}
+	return &scheduler{
+		store:   store,
+		key:     key,
+		loc:     loc,
+		sync:    sync,
+		clock:   sync.clock,
+		fire:    fire,
+		changed: make(chan struct{}, 1),
+	}
+}
+
+// Load reads the stored schedules, replacing the current ones.
+func (s *scheduler) Load() error {
+	data, err := s.store.Get(s.key)
+	if err != nil || len(data) == 0 {
+		// Stores report missing keys as errors
+		return nil
+	}
+
+	var schedules []*schedule
+	if err := json.Unmarshal(data, &schedules); err != nil {
+		return fmt.Errorf("decode %s: %w", s.key, err)
+	}
+	for _, sc := range schedules {
+		if sc.expr, err = parseCron(sc.Cron); err != nil {
+			return fmt.Errorf("decode %s: %w", s.key, err)
+		}
+	}
+
+	s.mu.Lock()
+	s.schedules = schedules
+	s.mu.Unlock()
+	s.wake()
+	return nil
+}
+
+// save writes the schedules to the store. Callers must hold s.mu.
+func (s *scheduler) save() error {
+	if len(s.schedules) == 0 {
+		if _, err := s.store.Get(s.key); err != nil {
+			return nil
+		}
+		return s.store.Delete(s.key)
+	}
+	data, err := json.Marshal(s.schedules)
+	if err != nil {
+		return err
+	}
+	return s.store.Set(s.key, data)
+}
+
+// Add parses expr and adds it as a new schedule.
+func (s *scheduler) Add(expr string) (schedule, error) {
+	c, err := parseCron(expr)
+	if err != nil {
+		return schedule{}, err
+	}
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return schedule{}, err
+	}
+	sc := &schedule{ID: hex.EncodeToString(id), Cron: expr, expr: c}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.schedules) >= maxSchedules {
+		return schedule{}, ErrTooManySchedules
+	}
+	s.schedules = append(s.schedules, sc)
+	if err := s.save(); err != nil {
+		s.schedules = s.schedules[:len(s.schedules)-1]
+		return schedule{}, err
+	}
+	s.wake()
+	return *sc, nil
+}
+
+// Remove deletes the schedule with the given id.
+// It returns false if there is no such schedule.
+func (s *scheduler) Remove(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, sc := range s.schedules {
+		if sc.ID != id {
+			continue
+		}
+		old := s.schedules
+		s.schedules = append(append([]*schedule{}, old[:i]...), old[i+1:]...)
+		if err := s.save(); err != nil {
+			s.schedules = old
+			return false, err
+		}
+		s.wake()
+		return true, nil
+	}
+	return false, nil
+}
+
+// List returns the schedules in the order they were added.
+func (s *scheduler) List() []schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]schedule, len(s.schedules))
+	for i, sc := range s.schedules {
+		list[i] = *sc
+	}
+	return list
+}
+
+// Upcoming returns up to n fire times of sc after now.
+func (s *scheduler) Upcoming(sc schedule, now time.Time, n int) []time.Time {
+	var times []time.Time
+	t := now.In(s.loc)
+	for len(times) < n {
+		if t = sc.expr.Next(t); t.IsZero() {
+			break
+		}
+		times = append(times, t)
+	}
+	return times
+}
+
+// Next returns up to n fire times after now across all schedules, in order.
+// Schedules due in the same minute fire once.
+func (s *scheduler) Next(now time.Time, n int) []time.Time {
+	var times []time.Time
+	for _, sc := range s.List() {
+		times = append(times, s.Upcoming(sc, now, n)...)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+
+	var merged []time.Time
+	for _, t := range times {
+		if len(merged) > 0 && merged[len(merged)-1].Equal(t) {
+			continue
+		}
+		if len(merged) == n {
+			break
+		}
+		merged = append(merged, t)
+	}
+	return merged
+}
+
+// wake makes Run recompute the next fire time.
+func (s *scheduler) wake() {
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Run calls fire whenever a schedule is due, until ctx is cancelled.
+// While the wall clock is not synced, schedules wait rather than fire at the
+// wrong time; call wake once it is.
+func (s *scheduler) Run(ctx context.Context) {
+	for {
+		due := make(chan struct{}, 1)
+		var timer ClockTimer
+		now := s.clock.Now()
+		if next := s.Next(now, 1); len(next) > 0 && s.sync.Synced() {
+			timer = s.clock.AfterFunc(next[0].Sub(now), func() { due <- struct{}{} })
+		}
+
+		select {
+		case <-due:
+			s.fire()
+		case <-s.changed:
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
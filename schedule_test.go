@@ -0,0 +1,141 @@
+package main
+
+import (
+	"github.com/brutella/hap"
+
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestSchedulerAddRemove verifies schedules are persisted and removed by id
+func TestSchedulerAddRemove(t *testing.T) {
+	store := hap.NewMemStore()
+	s := newScheduler(store, schedulesStoreKey, time.UTC, newClockSync(realClock{}, nil), func() {})
+
+	sc, err := s.Add("30 7 * * MON-FRI")
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if sc.ID == "" || sc.Cron != "30 7 * * MON-FRI" {
+		t.Errorf("Added schedule = %+v, expected id and cron expression", sc)
+	}
+
+	// A new scheduler on the same store loads the schedule
+	loaded := newScheduler(store, schedulesStoreKey, time.UTC, newClockSync(realClock{}, nil), func() {})
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if list := loaded.List(); len(list) != 1 || list[0].ID != sc.ID {
+		t.Fatalf("Loaded schedules = %+v, expected %s", list, sc.ID)
+	}
+
+	if ok, err := s.Remove("unknown"); ok || err != nil {
+		t.Errorf("Remove(unknown) = %v, %v; expected false, nil", ok, err)
+	}
+	if ok, err := s.Remove(sc.ID); !ok || err != nil {
+		t.Errorf("Remove = %v, %v; expected true, nil", ok, err)
+	}
+	if _, err := store.Get(schedulesStoreKey); err == nil {
+		t.Error("Schedules still stored after removing the last one")
+	}
+}
+
+// TestSchedulerAddInvalid verifies invalid expressions are not stored
+func TestSchedulerAddInvalid(t *testing.T) {
+	s := newScheduler(hap.NewMemStore(), schedulesStoreKey, time.UTC, newClockSync(realClock{}, nil), func() {})
+	if _, err := s.Add("every day"); !errors.Is(err, errInvalidCron) {
+		t.Errorf("Add error = %v, expected invalid cron expression", err)
+	}
+	if len(s.List()) != 0 {
+		t.Error("Invalid schedule was added")
+	}
+}
+
+// TestSchedulerLimit verifies at most maxSchedules can be added
+func TestSchedulerLimit(t *testing.T) {
+	s := newScheduler(hap.NewMemStore(), schedulesStoreKey, time.UTC, newClockSync(realClock{}, nil), func() {})
+	for i := 0; i < maxSchedules; i++ {
+		if _, err := s.Add("@daily"); err != nil {
+			t.Fatalf("Add %d failed: %v", i, err)
+		}
+	}
+	if _, err := s.Add("@daily"); !errors.Is(err, ErrTooManySchedules) {
+		t.Errorf("Add error = %v, expected ErrTooManySchedules", err)
+	}
+}
+
+// TestSchedulerLoadCorrupt verifies a corrupt document is reported as an error
+func TestSchedulerLoadCorrupt(t *testing.T) {
+	store := hap.NewMemStore()
+	store.Set(schedulesStoreKey, []byte(`[{"id":"1","cron":"bogus"}]`))
+	s := newScheduler(store, schedulesStoreKey, time.UTC, newClockSync(realClock{}, nil), func() {})
+
+	if err := s.Load(); err == nil {
+		t.Error("Expected error for corrupt document")
+	}
+}
+
+// TestSchedulerNext verifies fire times are merged across schedules in order
+func TestSchedulerNext(t *testing.T) {
+	s := newScheduler(hap.NewMemStore(), schedulesStoreKey, time.UTC, newClockSync(realClock{}, nil), func() {})
+	s.Add("0 12 * * *")
+	s.Add("0 6,12 * * *")
+
+	now := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+	expected := []time.Time{
+		time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC),
+		time.Date(2026, 1, 16, 6, 0, 0, 0, time.UTC),
+		time.Date(2026, 1, 16, 12, 0, 0, 0, time.UTC),
+	}
+
+	next := s.Next(now, 3)
+	if len(next) != len(expected) {
+		t.Fatalf("Next = %v, expected %v", next, expected)
+	}
+	for i := range expected {
+		if !next[i].Equal(expected[i]) {
+			t.Errorf("Next[%d] = %v, expected %v", i, next[i], expected[i])
+		}
+	}
+}
+
+// TestSchedulerRun verifies Run fires when a schedule is due and picks up changes
+func TestSchedulerRun(t *testing.T) {
+	clock := newFakeClock(testEpoch)
+	fired := make(chan time.Time, 1)
+	s := newScheduler(hap.NewMemStore(), schedulesStoreKey, time.UTC, newClockSync(clock, nil), func() {
+		fired <- clock.Now()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+
+	// Adding a schedule wakes Run to wait for it
+	if _, err := s.Add("0 13 * * *"); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	clock.WaitPending(1)
+	clock.Advance(time.Hour)
+
+	select {
+	case at := <-fired:
+		if expected := testEpoch.Add(time.Hour); !at.Equal(expected) {
+			t.Errorf("Fired at %v, expected %v", at, expected)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Schedule did not fire")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not stop after cancel")
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"github.com/brutella/hap"
+	"github.com/brutella/hap/accessory"
+	"github.com/skip2/go-qrcode"
+
+	"fmt"
+	"io"
+	"regexp"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// Pairing defaults, matching hap's built-in pin so existing setups keep working
+const (
+	defaultSetupPin = "00102003"
+	defaultSetupID  = "HKTM"
+)
+
+// version is the firmware revision reported to HomeKit. Release builds set it
+// with -ldflags "-X main.version=1.2.3"; otherwise it comes from the build info.
+var version string
+
+// setupIDPattern is the format of a HomeKit setup id.
+var setupIDPattern = regexp.MustCompile(`^[0-9A-Z]{4}$`)
+
+// firmwareVersionPattern extracts the x.y.z part of a module version, as
+// HomeKit only accepts numeric firmware revisions.
+var firmwareVersionPattern = regexp.MustCompile(`^v?(\d+\.\d+\.\d+)`)
+
+// accessoryIdentity is the accessory information shown in the Home app.
+// Empty fields keep the accessory's defaults.
+type accessoryIdentity struct {
+	Name         string
+	Manufacturer string
+	Model        string
+	SerialNumber string
+	Firmware     string
+}
+
+// apply sets the non-empty fields on a.
+func (id accessoryIdentity) apply(a *accessory.A) {
+	if id.Name != "" {
+		a.Info.Name.SetValue(id.Name)
+	}
+	if id.Manufacturer != "" {
+		a.Info.Manufacturer.SetValue(id.Manufacturer)
+	}
+	if id.Model != "" {
+		a.Info.Model.SetValue(id.Model)
+	}
+	if id.SerialNumber != "" {
+		a.Info.SerialNumber.SetValue(id.SerialNumber)
+	}
+	if id.Firmware != "" {
+		a.Info.FirmwareRevision.SetValue(id.Firmware)
+	}
+}
+
+// firmwareVersion returns the firmware revision of this build, or "0.0.0"
+// for development builds without a version.
+func firmwareVersion() string {
+	v := version
+	if v == "" {
+		if info, ok := debug.ReadBuildInfo(); ok {
+			v = info.Main.Version
+		}
+	}
+	if m := firmwareVersionPattern.FindStringSubmatch(v); m != nil {
+		return m[1]
+	}
+	return "0.0.0"
+}
+
+// parseSetupPin validates a setup pin given as 8 digits, optionally
+// formatted as XXX-XX-XXX, and returns the digits.
+func parseSetupPin(s string) (string, error) {
+	pin := strings.ReplaceAll(s, "-", "")
+	if len(pin) != 8 || strings.Trim(pin, "0123456789") != "" {
+		return "", fmt.Errorf("setup pin %q must have 8 digits", s)
+	}
+	if hap.InvalidPins[pin] {
+		return "", fmt.Errorf("setup pin %q is too easy to guess", s)
+	}
+	return pin, nil
+}
+
+// validSetupID reports whether id is 4 digits or upper case letters.
+func validSetupID(id string) bool {
+	return setupIDPattern.MatchString(id)
+}
+
+// formatSetupPin formats pin as XXX-XX-XXX, like the Home app shows it.
+func formatSetupPin(pin string) string {
+	return pin[:3] + "-" + pin[3:5] + "-" + pin[5:]
+}
+
+// setupURI returns the X-HM:// URI that the Home app scans to pair an IP
+// accessory of category with pin and setupID.
+func setupURI(category byte, pin, setupID string) string {
+	code, _ := strconv.ParseUint(pin, 10, 64)
+
+	// Version (0), reserved bits (0), category, flags (IP) and the pin
+	const flagIP = 2
+	payload := uint64(category)<<31 | flagIP<<27 | code
+	s := strings.ToUpper(strconv.FormatUint(payload, 36))
+	return "X-HM://" + strings.Repeat("0", max(9-len(s), 0)) + s + setupID
+}
+
+// printSetup writes the pairing details to w: the setup code and URI, and a
+// QR code of the URI to scan in the Home app unless the accessory is paired.
+func printSetup(w io.Writer, category byte, pin, setupID string, paired bool) {
+	uri := setupURI(category, pin, setupID)
+	fmt.Fprintf(w, "Setup code %s, setup URI %s\n", formatSetupPin(pin), uri)
+	if paired {
+		fmt.Fprintln(w, "Already paired, remove the accessory from the Home app to pair again")
+		return
+	}
+
+	qr, err := qrcode.New(uri, qrcode.Medium)
+	if err != nil {
+		fmt.Fprintf(w, "Failed to create setup QR code: %s\n", err)
+		return
+	}
+	// Light modules are drawn, so the code scans on a dark terminal
+	fmt.Fprint(w, qr.ToSmallString(false))
+}
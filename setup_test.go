@@ -0,0 +1,120 @@
+package main
+
+import (
+	"github.com/brutella/hap"
+	"github.com/brutella/hap/accessory"
+
+	"strings"
+	"testing"
+)
+
+// TestParseSetupPin verifies pin formats and rejection of weak pins
+func TestParseSetupPin(t *testing.T) {
+	for _, s := range []string{"03145154", "031-45-154"} {
+		if pin, err := parseSetupPin(s); err != nil || pin != "03145154" {
+			t.Errorf("parseSetupPin(%q) = %q, %v, expected 03145154", s, pin, err)
+		}
+	}
+	for _, s := range []string{"", "1234567", "123456789", "1234567a", "12345678", "00000000"} {
+		if _, err := parseSetupPin(s); err == nil {
+			t.Errorf("parseSetupPin(%q) succeeded, expected error", s)
+		}
+	}
+	if s := formatSetupPin("03145154"); s != "031-45-154" {
+		t.Errorf("formatSetupPin = %q, expected 031-45-154", s)
+	}
+}
+
+// TestValidSetupID verifies setup id validation
+func TestValidSetupID(t *testing.T) {
+	if !validSetupID(defaultSetupID) || !validSetupID("7X2Q") {
+		t.Error("Valid setup id rejected")
+	}
+	for _, id := range []string{"", "ABC", "ABCDE", "abcd", "AB-D"} {
+		if validSetupID(id) {
+			t.Errorf("validSetupID(%q) = true, expected false", id)
+		}
+	}
+}
+
+// TestSetupURI verifies the setup payload encoding
+func TestSetupURI(t *testing.T) {
+	testCases := []struct {
+		category byte
+		pin      string
+		expected string
+	}{
+		// Category 8 << 31 | IP flag 2 << 27 | 102003 in base 36
+		{accessory.TypeSwitch, defaultSetupPin, "X-HM://0080KBWQBHKTM"},
+		{accessory.TypeBridge, "03145154", "X-HM://0023ISYWYHKTM"}, // HAP-NodeJS example
+		// Short payloads are padded to 9 characters
+		{0, "00000001", "X-HM://0004FTI4HHKTM"},
+	}
+	for _, tc := range testCases {
+		if uri := setupURI(tc.category, tc.pin, defaultSetupID); uri != tc.expected {
+			t.Errorf("setupURI(%d, %s) = %s, expected %s", tc.category, tc.pin, uri, tc.expected)
+		}
+	}
+}
+
+// TestFirmwareVersion verifies the version is reduced to the numeric form HomeKit accepts
+func TestFirmwareVersion(t *testing.T) {
+	defer func(v string) { version = v }(version)
+
+	testCases := map[string]string{
+		"1.2.3":                              "1.2.3",
+		"v0.4.1":                             "0.4.1",
+		"v0.0.0-20260115120000-abcdef123456": "0.0.0",
+		"(devel)":                            "0.0.0",
+	}
+	for v, expected := range testCases {
+		version = v
+		if fw := firmwareVersion(); fw != expected {
+			t.Errorf("firmwareVersion() for %q = %q, expected %q", v, fw, expected)
+		}
+	}
+}
+
+// TestPrintSetup verifies the QR code is only printed before pairing
+func TestPrintSetup(t *testing.T) {
+	var b strings.Builder
+	printSetup(&b, accessory.TypeSwitch, defaultSetupPin, defaultSetupID, false)
+	out := b.String()
+	if !strings.Contains(out, "001-02-003") || !strings.Contains(out, "X-HM://0080KBWQBHKTM") {
+		t.Errorf("Setup output lacks code or URI:\n%s", out)
+	}
+	if !strings.Contains(out, "█") {
+		t.Error("Setup output lacks QR code")
+	}
+
+	b.Reset()
+	printSetup(&b, accessory.TypeSwitch, defaultSetupPin, defaultSetupID, true)
+	if strings.Contains(b.String(), "█") {
+		t.Error("QR code printed although already paired")
+	}
+}
+
+// TestTimerSetIdentity verifies the identity of single and bridged accessories
+func TestTimerSetIdentity(t *testing.T) {
+	id := accessoryIdentity{Name: "Kitchen timer", Manufacturer: "ACME", SerialNumber: "42", Firmware: "1.2.3"}
+
+	ts := newTimerSet([]string{defaultTimerName}, hap.NewMemStore(), timerConfig{Identity: id})
+	a, _, _ := ts.Accessories()
+	if a.Info.Name.Value() != "Kitchen timer" || a.Info.SerialNumber.Value() != "42" || a.Info.FirmwareRevision.Value() != "1.2.3" {
+		t.Errorf("Accessory identity = %q, %q, %q", a.Info.Name.Value(), a.Info.SerialNumber.Value(), a.Info.FirmwareRevision.Value())
+	}
+
+	ts = newTimerSet([]string{"a", "b"}, hap.NewMemStore(), timerConfig{Identity: id})
+	bridge, as, _ := ts.Accessories()
+	if bridge.Info.Name.Value() != "Kitchen timer" {
+		t.Errorf("Bridge name = %q, expected Kitchen timer", bridge.Info.Name.Value())
+	}
+	for _, a := range as {
+		if a.Info.Name.Value() == "Kitchen timer" || a.Info.SerialNumber.Value() == "42" {
+			t.Error("Bridged accessory got the bridge name or serial number")
+		}
+		if a.Info.Manufacturer.Value() != "ACME" {
+			t.Errorf("Bridged manufacturer = %q, expected ACME", a.Info.Manufacturer.Value())
+		}
+	}
+}
@@ -1,73 +1,433 @@
 package main
 
 import (
-	"sync/atomic"
+	"errors"
+	"sync"
 	"time"
 )
 
-// SecondsTimer wraps time.Timer and tracks the end time atomically.
-// This allows thread-safe access to timer state from multiple goroutines,
-// particularly for calculating time remaining and formatting end times.
+// TimerState is the lifecycle state of a SecondsTimer.
+type TimerState string
+
+// Timer states
+const (
+	StateIdle      TimerState = "idle"      // Never armed
+	StateArmed     TimerState = "armed"     // Counting down
+	StatePaused    TimerState = "paused"    // Countdown suspended, remaining time kept
+	StateFired     TimerState = "fired"     // Countdown reached zero
+	StateCancelled TimerState = "cancelled" // Countdown stopped before firing
+)
+
+// Errors returned by operations that need a particular timer state
+var (
+	ErrNotRunning = errors.New("timer is not armed or paused")
+	ErrNotArmed   = errors.New("timer is not armed")
+	ErrNotPaused  = errors.New("timer is not paused")
+	ErrOutOfRange = errors.New("timer out of range")
+)
+
+// TimerStatus is a consistent snapshot of a SecondsTimer.
+type TimerStatus struct {
+	State     TimerState
+	End       time.Time     // When the timer fires; zero unless armed
+	Left      time.Duration // Remaining time when the snapshot was taken; zero unless armed
+	Paused    time.Duration // Remaining time kept while paused
+	LastFired time.Time     // When the timer last fired; zero if it never has
+	Absolute  bool          // Armed for a wall-clock time by ResetAt
+
+	// Source is what caused the change reported to OnChange callbacks, see
+	// SecondsTimer.Via. It is empty for the countdown running out and in
+	// Status, and sourceClock for Resync.
+	Source string
+}
+
+// SecondsTimer is a one-shot countdown with an explicit state.
+// State, end time and last fire time change together under a mutex, so
+// readers on other goroutines never see an end time from a stale countdown.
+//
+// Countdowns run on the monotonic clock, so wall-clock steps don't change how
+// long they take; see Resync for how the reported end time follows a step.
 type SecondsTimer struct {
-	timer *time.Timer
-	end   atomic.Value // stores time.Time - provides lock-free thread safety
+	clock Clock
+
+	mu        sync.Mutex
+	timer     ClockTimer // pending countdown; nil unless armed
+	gen       uint64     // incremented on every transition to discard stale fires
+	state     TimerState
+	end       time.Time     // reported end on the wall clock
+	deadline  time.Duration // end on the monotonic clock, see Clock.Elapsed
+	absolute  bool          // armed for a wall-clock time by ResetAt
+	paused    time.Duration // remaining time while paused
+	lastFired time.Time
+
+	c chan time.Time // buffered fire events, see C
+
+	notifyMu sync.Mutex                 // serialises callbacks in transition order
+	onChange []func(status TimerStatus) // called after every state change
+}
+
+// NewIdleTimer creates a timer that is not armed.
+func NewIdleTimer() *SecondsTimer {
+	return NewIdleTimerWithClock(realClock{})
+}
+
+// NewIdleTimerWithClock creates a timer that is not armed and takes its time from clock.
+func NewIdleTimerWithClock(clock Clock) *SecondsTimer {
+	return &SecondsTimer{
+		clock: clock,
+		state: StateIdle,
+		c:     make(chan time.Time, 1),
+	}
 }
 
 // NewSecondsTimer creates a new timer that will fire after duration t.
-// The timer starts immediately and the end time is calculated and stored atomically.
+// The timer starts immediately.
 func NewSecondsTimer(t time.Duration) *SecondsTimer {
-	st := &SecondsTimer{timer: time.NewTimer(t)}
-	st.end.Store(time.Now().Add(t))
+	st := NewIdleTimer()
+	st.Reset(t)
 	return st
 }
 
-// Reset changes the timer to expire after duration t.
-// It safely handles the case where the timer has already fired by draining
-// the channel in a non-blocking way. This follows Go's timer best practices.
-func (s *SecondsTimer) Reset(t time.Duration) {
-	// Attempt to stop the timer first
-	if !s.timer.Stop() {
-		// Timer already fired or was stopped - drain channel if needed
-		select {
-		case <-s.timer.C:
-			// Successfully drained
-		default:
-			// Channel was already empty, nothing to do
-		}
-	}
-	// Now it's safe to reset the timer
-	s.timer.Reset(t)
-	s.end.Store(time.Now().Add(t))
+// SourcedTimer changes a SecondsTimer on behalf of Source, which the OnChange
+// callbacks receive in TimerStatus.Source. Passing the source along with each
+// change keeps it attached to that change, even while the countdown runs out
+// on another goroutine.
+type SourcedTimer struct {
+	*SecondsTimer
+	Source string
 }
 
-// Stop prevents the timer from firing.
+// Via returns the operations of the timer attributed to source.
+// Calling them directly on the timer attributes the change to nobody.
+func (s *SecondsTimer) Via(source string) SourcedTimer {
+	return SourcedTimer{s, source}
+}
+
+// Reset arms the timer to expire after duration t, replacing any pending countdown.
+// A fire event that has not been received from C yet is discarded.
+func (s *SecondsTimer) Reset(t time.Duration) { s.Via("").Reset(t) }
+
+// ResetAt arms the timer to expire at the wall-clock time end, replacing any
+// pending countdown like Reset. End and Status report end as given, in its
+// own location. An end in the past fires immediately.
+func (s *SecondsTimer) ResetAt(end time.Time) { s.Via("").ResetAt(end) }
+
+// Stop cancels a pending or paused countdown.
 // It returns true if the call stops the timer, false if the timer has already
 // expired or been stopped.
-func (s *SecondsTimer) Stop() bool {
-	return s.timer.Stop()
+func (s *SecondsTimer) Stop() bool { return s.Via("").Stop() }
+
+// Pause suspends an armed countdown, keeping its remaining time for Resume.
+func (s *SecondsTimer) Pause() error { return s.Via("").Pause() }
+
+// ResetPaused replaces any pending countdown with a paused one of duration t.
+func (s *SecondsTimer) ResetPaused(t time.Duration) { s.Via("").ResetPaused(t) }
+
+// Resume re-arms a paused countdown with the remaining time it had when paused.
+func (s *SecondsTimer) Resume() error { return s.Via("").Resume() }
+
+// Adjust adds d (which may be negative) to the remaining time of an armed or
+// paused countdown, relative to its current end rather than replacing it.
+// It returns ErrOutOfRange, leaving the timer unchanged, if the new remaining
+// time would fall outside 0 to limit.
+func (s *SecondsTimer) Adjust(d, limit time.Duration) (time.Duration, error) {
+	return s.Via("").Adjust(d, limit)
+}
+
+// Fire moves the timer to StateFired now, as if the countdown had expired,
+// cancelling any pending or paused countdown. Unlike an expiry, no event is
+// delivered on C, so the caller is responsible for the effects of firing.
+func (s *SecondsTimer) Fire() { s.Via("").Fire() }
+
+// Reset is SecondsTimer.Reset on behalf of st.Source.
+func (st SourcedTimer) Reset(t time.Duration) {
+	s := st.SecondsTimer
+	s.mu.Lock()
+	s.resetLocked()
+	s.armLocked(t, false)
+	s.notify(st.Source)
+}
+
+// ResetAt is SecondsTimer.ResetAt on behalf of st.Source.
+func (st SourcedTimer) ResetAt(end time.Time) {
+	s := st.SecondsTimer
+	s.mu.Lock()
+	s.resetLocked()
+	s.armLocked(end.Sub(s.clock.Now()), true)
+	s.end = end
+	s.notify(st.Source)
+}
+
+// resetLocked stops the pending countdown and discards a fire event that has
+// not been received yet. Callers must hold s.mu.
+func (s *SecondsTimer) resetLocked() {
+	s.stopLocked()
+
+	// Drain a fire event from the previous countdown in a non-blocking way
+	select {
+	case <-s.c:
+	default:
+	}
+}
+
+// Stop is SecondsTimer.Stop on behalf of st.Source.
+func (st SourcedTimer) Stop() bool {
+	s := st.SecondsTimer
+	s.mu.Lock()
+	if s.state != StateArmed && s.state != StatePaused {
+		s.mu.Unlock()
+		return false
+	}
+	s.stopLocked()
+	s.gen++
+	s.state = StateCancelled
+	s.end = time.Time{}
+	s.paused = 0
+	s.notify(st.Source)
+	return true
+}
+
+// Pause is SecondsTimer.Pause on behalf of st.Source.
+func (st SourcedTimer) Pause() error {
+	s := st.SecondsTimer
+	s.mu.Lock()
+	if s.state != StateArmed {
+		s.mu.Unlock()
+		return ErrNotArmed
+	}
+	s.stopLocked()
+	s.gen++
+	s.paused = s.remainingLocked()
+	s.state = StatePaused
+	s.end = time.Time{}
+	s.notify(st.Source)
+	return nil
+}
+
+// ResetPaused is SecondsTimer.ResetPaused on behalf of st.Source.
+func (st SourcedTimer) ResetPaused(t time.Duration) {
+	s := st.SecondsTimer
+	s.mu.Lock()
+	s.resetLocked()
+	s.gen++
+	s.state = StatePaused
+	s.end = time.Time{}
+	s.paused = t
+	s.notify(st.Source)
+}
+
+// Resume is SecondsTimer.Resume on behalf of st.Source.
+func (st SourcedTimer) Resume() error {
+	s := st.SecondsTimer
+	s.mu.Lock()
+	if s.state != StatePaused {
+		s.mu.Unlock()
+		return ErrNotPaused
+	}
+	s.armLocked(s.paused, false)
+	s.notify(st.Source)
+	return nil
+}
+
+// Adjust is SecondsTimer.Adjust on behalf of st.Source.
+func (st SourcedTimer) Adjust(d, limit time.Duration) (time.Duration, error) {
+	s := st.SecondsTimer
+	s.mu.Lock()
+	var remaining time.Duration
+	switch s.state {
+	case StateArmed:
+		remaining = s.remainingLocked() + d
+	case StatePaused:
+		remaining = s.paused + d
+	default:
+		s.mu.Unlock()
+		return 0, ErrNotRunning
+	}
+	if remaining < 0 || remaining > limit {
+		s.mu.Unlock()
+		return 0, ErrOutOfRange
+	}
+
+	if s.state == StatePaused {
+		s.paused = remaining
+	} else {
+		s.stopLocked()
+		s.armLocked(remaining, s.absolute)
+	}
+	s.notify(st.Source)
+	return remaining, nil
+}
+
+// armLocked starts a countdown of duration d. absolute marks countdowns to a
+// wall-clock time, which Resync keeps at that time. Callers must hold s.mu and
+// have stopped any pending countdown.
+func (s *SecondsTimer) armLocked(d time.Duration, absolute bool) {
+	s.gen++
+	gen := s.gen
+	s.state = StateArmed
+	s.end = s.clock.Now().Add(d)
+	s.deadline = s.clock.Elapsed() + d
+	s.absolute = absolute
+	s.paused = 0
+	s.timer = s.clock.AfterFunc(d, func() { s.fire(gen) })
+}
+
+// remainingLocked returns the time until an armed countdown fires.
+// Callers must hold s.mu.
+func (s *SecondsTimer) remainingLocked() time.Duration {
+	return max(s.deadline-s.clock.Elapsed(), 0)
+}
+
+// Resync updates an armed countdown after the wall clock stepped. Relative
+// countdowns keep their remaining time and move their reported end time;
+// countdowns armed by ResetAt keep their end time and are rescheduled for it.
+// OnChange callbacks see the change with sourceClock, so they can follow the
+// new end time without treating it as the timer being set again.
+func (s *SecondsTimer) Resync() {
+	s.mu.Lock()
+	if s.state != StateArmed {
+		s.mu.Unlock()
+		return
+	}
+	if s.absolute {
+		end := s.end
+		s.stopLocked()
+		s.armLocked(end.Sub(s.clock.Now()), true)
+		s.end = end
+	} else {
+		s.end = s.clock.Now().Add(s.remainingLocked())
+	}
+	s.notify(sourceClock)
+}
+
+// Fire is SecondsTimer.Fire on behalf of st.Source.
+func (st SourcedTimer) Fire() {
+	s := st.SecondsTimer
+	s.mu.Lock()
+	s.stopLocked()
+	s.gen++
+	s.state = StateFired
+	s.end = time.Time{}
+	s.paused = 0
+	s.lastFired = s.clock.Now()
+	s.notify(st.Source)
+}
+
+// fire moves the timer to StateFired and delivers the event on C.
+// gen identifies the countdown that scheduled the call.
+func (s *SecondsTimer) fire(gen uint64) {
+	s.mu.Lock()
+	if gen != s.gen {
+		// Countdown was replaced or stopped while this call was scheduled
+		s.mu.Unlock()
+		return
+	}
+	now := s.clock.Now()
+	s.timer = nil
+	s.state = StateFired
+	s.end = time.Time{}
+	s.lastFired = now
+
+	select {
+	case s.c <- now:
+	default:
+		// Previous event was not received yet; one pending event is enough
+	}
+	s.notify("")
+}
+
+// stopLocked stops the pending countdown. Callers must hold s.mu.
+func (s *SecondsTimer) stopLocked() {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+}
+
+// notify runs the OnChange callbacks with the current status, caused by
+// source, and unlocks s.mu. Callers must hold s.mu. Taking notifyMu before releasing s.mu keeps callbacks
+// in the same order as the transitions they report.
+func (s *SecondsTimer) notify(source string) {
+	status := s.statusLocked()
+	status.Source = source
+	s.notifyMu.Lock()
+	s.mu.Unlock()
+	defer s.notifyMu.Unlock()
+
+	for _, fn := range s.onChange {
+		fn(status)
+	}
+}
+
+// OnChange registers fn to be called with the new status after every state change.
+// Callbacks run synchronously in transition order and must not modify the timer.
+func (s *SecondsTimer) OnChange(fn func(status TimerStatus)) {
+	s.notifyMu.Lock()
+	defer s.notifyMu.Unlock()
+	s.onChange = append(s.onChange, fn)
+}
+
+// Status returns a consistent snapshot of the timer.
+func (s *SecondsTimer) Status() TimerStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.statusLocked()
+}
+
+// statusLocked returns the current status. Callers must hold s.mu.
+func (s *SecondsTimer) statusLocked() TimerStatus {
+	st := TimerStatus{
+		State:     s.state,
+		End:       s.end,
+		Paused:    s.paused,
+		LastFired: s.lastFired,
+	}
+	if s.state == StateArmed {
+		st.Left = s.remainingLocked()
+		st.Absolute = s.absolute
+	}
+	return st
+}
+
+// State returns the current state of the timer.
+func (s *SecondsTimer) State() TimerState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
 }
 
 // TimeRemaining returns the duration until the timer fires.
 // Returns 0 if the timer has already expired or is not set.
 // This method is thread-safe and can be called from multiple goroutines.
 func (s *SecondsTimer) TimeRemaining() time.Duration {
-	endTime := s.end.Load().(time.Time)
-	remaining := endTime.Sub(time.Now())
-	if remaining > 0 {
-		return remaining
-	}
-	return time.Duration(0)
+	return s.Status().Remaining()
 }
 
-// End returns the time when the timer will expire.
+// Now returns the current time of the timer's clock.
+func (s *SecondsTimer) Now() time.Time {
+	return s.clock.Now()
+}
+
+// End returns the time when the timer will expire, or the zero time if it is not armed.
 // This method is thread-safe and can be called from multiple goroutines.
 func (s *SecondsTimer) End() time.Time {
-	return s.end.Load().(time.Time)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.end
 }
 
 // C returns the timer's channel for receiving expiration events.
 // The channel is read-only to prevent external code from sending values.
 // Callers should read from this channel to know when the timer fires.
 func (s *SecondsTimer) C() <-chan time.Time {
-	return s.timer.C
+	return s.c
+}
+
+// Remaining returns the duration until the timer fires, the remaining time
+// kept while paused, or 0 if it is neither armed nor paused.
+func (st TimerStatus) Remaining() time.Duration {
+	if st.State == StatePaused {
+		return st.Paused
+	}
+	return st.Left
 }
@@ -6,6 +6,17 @@ import (
 	"time"
 )
 
+// testEpoch is the start time of fake clocks in tests
+var testEpoch = time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)
+
+// newFakeTimer creates a timer armed for d on a fake clock starting at testEpoch
+func newFakeTimer(d time.Duration) (*SecondsTimer, *fakeClock) {
+	clock := newFakeClock(testEpoch)
+	timer := NewIdleTimerWithClock(clock)
+	timer.Reset(d)
+	return timer, clock
+}
+
 // TestNewSecondsTimer verifies that a new timer is created with correct initial state
 func TestNewSecondsTimer(t *testing.T) {
 	duration := 5 * time.Second
@@ -30,29 +41,38 @@ func TestNewSecondsTimer(t *testing.T) {
 
 // TestTimerReset verifies that Reset correctly updates the timer
 func TestTimerReset(t *testing.T) {
-	timer := NewSecondsTimer(time.Hour)
+	timer, clock := newFakeTimer(time.Hour)
 	timer.Stop()
 
-	// Reset to a new duration
-	newDuration := 10 * time.Second
-	timer.Reset(newDuration)
-
-	// Verify end time is updated
-	expectedEnd := time.Now().Add(newDuration)
-	actualEnd := timer.End()
-	diff := actualEnd.Sub(expectedEnd).Abs()
+	clock.Advance(time.Minute)
+	timer.Reset(10 * time.Second)
 
-	if diff > 100*time.Millisecond {
-		t.Errorf("After Reset, end time diff too large: diff=%v", diff)
+	if expected := testEpoch.Add(time.Minute + 10*time.Second); !timer.End().Equal(expected) {
+		t.Errorf("After Reset, End = %v, expected %v", timer.End(), expected)
+	}
+	if clock.Pending() != 1 {
+		t.Errorf("Pending countdowns = %d, expected 1", clock.Pending())
 	}
+}
 
-	// Clean up
-	timer.Stop()
+// TestTimerResetAt verifies ResetAt keeps the requested end time and location
+func TestTimerResetAt(t *testing.T) {
+	timer, _ := newFakeTimer(0)
+
+	end := testEpoch.Add(time.Minute).In(time.FixedZone("", 2*60*60))
+	timer.ResetAt(end)
+
+	if got := timer.End(); !got.Equal(end) || got.Location() != end.Location() {
+		t.Errorf("End = %v, expected %v", got, end)
+	}
+	if remaining := timer.TimeRemaining(); remaining != time.Minute {
+		t.Errorf("TimeRemaining = %v, expected 1m", remaining)
+	}
 }
 
 // TestTimerStop verifies that Stop prevents timer from firing
 func TestTimerStop(t *testing.T) {
-	timer := NewSecondsTimer(100 * time.Millisecond)
+	timer, clock := newFakeTimer(100 * time.Millisecond)
 
 	// Stop immediately
 	stopped := timer.Stop()
@@ -61,8 +81,7 @@ func TestTimerStop(t *testing.T) {
 		t.Error("Stop() returned false, expected true for active timer")
 	}
 
-	// Wait to ensure timer doesn't fire
-	time.Sleep(200 * time.Millisecond)
+	clock.Advance(time.Second)
 
 	// Timer should not have fired
 	select {
@@ -75,41 +94,52 @@ func TestTimerStop(t *testing.T) {
 
 // TestTimerTimeRemaining verifies TimeRemaining calculation
 func TestTimerTimeRemaining(t *testing.T) {
-	duration := 2 * time.Second
-	timer := NewSecondsTimer(duration)
-	defer timer.Stop()
+	timer, clock := newFakeTimer(2 * time.Second)
 
-	// Check immediately after creation
-	remaining := timer.TimeRemaining()
-	if remaining < time.Second || remaining > duration {
-		t.Errorf("TimeRemaining outside expected range: got %v, expected ~%v", remaining, duration)
+	if remaining := timer.TimeRemaining(); remaining != 2*time.Second {
+		t.Errorf("TimeRemaining = %v, expected 2s", remaining)
 	}
 
-	// Wait and check again
-	time.Sleep(500 * time.Millisecond)
-	remaining = timer.TimeRemaining()
-
-	if remaining < 1*time.Second || remaining > 2*time.Second {
-		t.Errorf("After 500ms, TimeRemaining = %v, expected ~1.5s", remaining)
+	clock.Advance(500 * time.Millisecond)
+	if remaining := timer.TimeRemaining(); remaining != 1500*time.Millisecond {
+		t.Errorf("After 500ms, TimeRemaining = %v, expected 1.5s", remaining)
 	}
 }
 
 // TestTimerTimeRemainingExpired verifies TimeRemaining returns 0 for expired timer
 func TestTimerTimeRemainingExpired(t *testing.T) {
-	timer := NewSecondsTimer(50 * time.Millisecond)
+	timer, clock := newFakeTimer(50 * time.Millisecond)
 
-	// Wait for expiration
-	time.Sleep(100 * time.Millisecond)
+	clock.Advance(100 * time.Millisecond)
 
-	remaining := timer.TimeRemaining()
-	if remaining != 0 {
+	if remaining := timer.TimeRemaining(); remaining != 0 {
 		t.Errorf("Expired timer TimeRemaining = %v, expected 0", remaining)
 	}
+}
+
+// TestTimerLong verifies a 30-day timer fires exactly at its end
+func TestTimerLong(t *testing.T) {
+	duration := 30 * 24 * time.Hour
+	timer, clock := newFakeTimer(duration)
 
-	// Drain the channel
+	clock.Advance(duration - time.Second)
+	if remaining := timer.TimeRemaining(); remaining != time.Second {
+		t.Errorf("TimeRemaining = %v, expected 1s", remaining)
+	}
 	select {
 	case <-timer.C():
+		t.Fatal("Timer fired early")
+	default:
+	}
+
+	clock.Advance(time.Second)
+	select {
+	case fired := <-timer.C():
+		if expected := testEpoch.Add(duration); !fired.Equal(expected) {
+			t.Errorf("Fired at %v, expected %v", fired, expected)
+		}
 	default:
+		t.Fatal("Timer did not fire after 30 days")
 	}
 }
 
@@ -161,34 +191,299 @@ func TestTimerConcurrentAccess(t *testing.T) {
 
 // TestTimerFiring verifies timer actually fires
 func TestTimerFiring(t *testing.T) {
-	duration := 100 * time.Millisecond
-	timer := NewSecondsTimer(duration)
+	timer := NewSecondsTimer(10 * time.Millisecond)
 
-	// Wait for timer to fire
+	// Wait for timer to fire on the real clock
 	select {
 	case <-timer.C():
 		// Expected - timer fired
-	case <-time.After(200 * time.Millisecond):
+	case <-time.After(time.Second):
 		t.Error("Timer did not fire within expected time")
 	}
 }
 
 // TestTimerResetMultipleTimes verifies multiple Reset calls work correctly
 func TestTimerResetMultipleTimes(t *testing.T) {
-	timer := NewSecondsTimer(time.Hour)
-	timer.Stop()
+	timer, clock := newFakeTimer(time.Hour)
 
 	for i := 0; i < 5; i++ {
 		duration := time.Duration(i+1) * time.Second
 		timer.Reset(duration)
 
-		remaining := timer.TimeRemaining()
-		if remaining < duration-100*time.Millisecond || remaining > duration {
-			t.Errorf("Reset #%d: TimeRemaining = %v, expected ~%v", i, remaining, duration)
+		if remaining := timer.TimeRemaining(); remaining != duration {
+			t.Errorf("Reset #%d: TimeRemaining = %v, expected %v", i, remaining, duration)
+		}
+	}
+
+	// Only the last countdown is pending
+	if clock.Pending() != 1 {
+		t.Errorf("Pending countdowns = %d, expected 1", clock.Pending())
+	}
+}
+
+// TestTimerStates verifies the state transitions of Reset, Stop and fire
+func TestTimerStates(t *testing.T) {
+	clock := newFakeClock(testEpoch)
+	timer := NewIdleTimerWithClock(clock)
+
+	if st := timer.Status(); st.State != StateIdle || !st.End.IsZero() || !st.LastFired.IsZero() {
+		t.Errorf("New idle timer status = %+v, expected idle with zero times", st)
+	}
+
+	timer.Reset(time.Hour)
+	if st := timer.Status(); st.State != StateArmed || st.End.IsZero() {
+		t.Errorf("After Reset status = %+v, expected armed with end time", st)
+	}
+
+	if !timer.Stop() {
+		t.Error("Stop() returned false for armed timer")
+	}
+	if st := timer.Status(); st.State != StateCancelled || !st.End.IsZero() {
+		t.Errorf("After Stop status = %+v, expected cancelled without end time", st)
+	}
+	if timer.Stop() {
+		t.Error("Stop() returned true for cancelled timer")
+	}
+
+	timer.Reset(time.Second)
+	clock.Advance(time.Second)
+	fired := <-timer.C()
+	st := timer.Status()
+	if st.State != StateFired || !st.End.IsZero() {
+		t.Errorf("After fire status = %+v, expected fired without end time", st)
+	}
+	if !st.LastFired.Equal(fired) || !fired.Equal(testEpoch.Add(time.Second)) {
+		t.Errorf("LastFired = %v, expected %v", st.LastFired, fired)
+	}
+	if timer.Stop() {
+		t.Error("Stop() returned true for fired timer")
+	}
+}
+
+// TestTimerPauseResume verifies pausing keeps the remaining time
+func TestTimerPauseResume(t *testing.T) {
+	timer, clock := newFakeTimer(time.Hour)
+	clock.Advance(time.Minute)
+
+	if err := timer.Resume(); err != ErrNotPaused {
+		t.Errorf("Resume on armed timer = %v, expected %v", err, ErrNotPaused)
+	}
+
+	if err := timer.Pause(); err != nil {
+		t.Fatalf("Pause failed: %v", err)
+	}
+	st := timer.Status()
+	if st.State != StatePaused || !st.End.IsZero() {
+		t.Errorf("After Pause status = %+v, expected paused without end time", st)
+	}
+	if st.Paused != 59*time.Minute {
+		t.Errorf("Paused remaining = %v, expected 59m", st.Paused)
+	}
+
+	// Time passing while paused doesn't count
+	clock.Advance(time.Hour)
+	if timer.TimeRemaining() != st.Paused {
+		t.Errorf("TimeRemaining while paused = %v, expected %v", timer.TimeRemaining(), st.Paused)
+	}
+
+	if err := timer.Pause(); err != ErrNotArmed {
+		t.Errorf("Pause on paused timer = %v, expected %v", err, ErrNotArmed)
+	}
+
+	if err := timer.Resume(); err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+	if timer.TimeRemaining() != st.Paused {
+		t.Errorf("TimeRemaining after Resume = %v, expected %v", timer.TimeRemaining(), st.Paused)
+	}
+}
+
+// TestTimerStopPaused verifies a paused timer can be cancelled
+func TestTimerStopPaused(t *testing.T) {
+	timer := NewSecondsTimer(time.Hour)
+	timer.Pause()
+
+	if !timer.Stop() {
+		t.Error("Stop() returned false for paused timer")
+	}
+	if st := timer.Status(); st.State != StateCancelled || st.Paused != 0 {
+		t.Errorf("After Stop status = %+v, expected cancelled", st)
+	}
+}
+
+// TestTimerAdjust verifies relative changes to armed and paused timers
+func TestTimerAdjust(t *testing.T) {
+	timer, clock := newFakeTimer(time.Minute)
+	end := timer.End()
+	clock.Advance(10 * time.Second)
+
+	if _, err := timer.Adjust(time.Minute, time.Hour); err != nil {
+		t.Fatalf("Adjust failed: %v", err)
+	}
+	if !timer.End().Equal(end.Add(time.Minute)) {
+		t.Errorf("End after Adjust = %v, expected %v", timer.End(), end.Add(time.Minute))
+	}
+
+	if _, err := timer.Adjust(-time.Hour, time.Hour); err != ErrOutOfRange {
+		t.Errorf("Adjust below zero = %v, expected %v", err, ErrOutOfRange)
+	}
+	if _, err := timer.Adjust(time.Hour, time.Hour); err != ErrOutOfRange {
+		t.Errorf("Adjust above limit = %v, expected %v", err, ErrOutOfRange)
+	}
+
+	timer.ResetPaused(time.Minute)
+	remaining, err := timer.Adjust(-30*time.Second, time.Hour)
+	if err != nil || remaining != 30*time.Second {
+		t.Errorf("Adjust paused = %v, %v; expected 30s", remaining, err)
+	}
+	if st := timer.Status(); st.State != StatePaused || st.Paused != 30*time.Second {
+		t.Errorf("After Adjust paused status = %+v, expected paused with 30s", st)
+	}
+
+	idle := NewIdleTimer()
+	if _, err := idle.Adjust(time.Minute, time.Hour); err != ErrNotRunning {
+		t.Errorf("Adjust on idle timer = %v, expected %v", err, ErrNotRunning)
+	}
+}
+
+// TestTimerFire verifies Fire records a fire without delivering on C
+func TestTimerFire(t *testing.T) {
+	timer, clock := newFakeTimer(time.Hour)
+
+	timer.Fire()
+
+	st := timer.Status()
+	if st.State != StateFired || !st.End.IsZero() || !st.LastFired.Equal(testEpoch) {
+		t.Errorf("After Fire status = %+v, expected fired with last fire time", st)
+	}
+
+	// The cancelled countdown doesn't deliver either
+	clock.Advance(2 * time.Hour)
+	select {
+	case <-timer.C():
+		t.Error("Fire delivered an event on C")
+	default:
+	}
+}
+
+// TestTimerResetDiscardsStaleFire verifies a fire replaced by Reset is not delivered
+func TestTimerResetDiscardsStaleFire(t *testing.T) {
+	timer, clock := newFakeTimer(time.Second)
+	clock.Advance(time.Second)
+
+	// Fire event is pending on C; Reset must drain it
+	timer.Reset(time.Hour)
+
+	select {
+	case <-timer.C():
+		t.Error("Stale fire delivered after Reset")
+	default:
+	}
+	if timer.State() != StateArmed {
+		t.Errorf("State = %s, expected %s", timer.State(), StateArmed)
+	}
+}
+
+// TestTimerOnChange verifies callbacks receive every transition in order
+func TestTimerOnChange(t *testing.T) {
+	clock := newFakeClock(testEpoch)
+	timer := NewIdleTimerWithClock(clock)
+
+	var got []TimerStatus
+	timer.OnChange(func(status TimerStatus) {
+		got = append(got, status)
+	})
+
+	timer.Reset(time.Minute)
+	timer.Stop()
+	timer.Reset(time.Second)
+	clock.Advance(time.Second)
+
+	expected := []TimerState{StateArmed, StateCancelled, StateArmed, StateFired}
+	if len(got) != len(expected) {
+		t.Fatalf("OnChange called %d times, expected %d", len(got), len(expected))
+	}
+	for i, state := range expected {
+		if got[i].State != state {
+			t.Errorf("Change #%d state = %s, expected %s", i, got[i].State, state)
 		}
 	}
+	if got[0].End.IsZero() {
+		t.Error("Armed change has no end time")
+	}
+}
+
+// TestTimerViaSource verifies changes carry the source they were made via,
+// while the countdown running out carries none
+func TestTimerViaSource(t *testing.T) {
+	clock := newFakeClock(testEpoch)
+	timer := NewIdleTimerWithClock(clock)
 
+	var got []string
+	timer.OnChange(func(status TimerStatus) {
+		got = append(got, status.Source)
+	})
+
+	timer.Via(sourceAPI).Reset(time.Second)
+	clock.Advance(time.Second)
+	timer.Via(sourceHomeKit).Reset(time.Minute)
 	timer.Stop()
+
+	expected := []string{sourceAPI, "", sourceHomeKit, ""}
+	if len(got) != len(expected) {
+		t.Fatalf("OnChange called %d times, expected %d", len(got), len(expected))
+	}
+	for i, source := range expected {
+		if got[i] != source {
+			t.Errorf("Change #%d source = %q, expected %q", i, got[i], source)
+		}
+	}
+	if source := timer.Status().Source; source != "" {
+		t.Errorf("Status source = %q, expected none", source)
+	}
+}
+
+// TestTimerResync verifies countdowns survive wall-clock steps
+func TestTimerResync(t *testing.T) {
+	t.Run("Relative", func(t *testing.T) {
+		timer, clock := newFakeTimer(time.Hour)
+
+		clock.Step(24 * time.Hour)
+		if remaining := timer.TimeRemaining(); remaining != time.Hour {
+			t.Errorf("TimeRemaining after step = %v, expected 1h", remaining)
+		}
+
+		timer.Resync()
+		if expected := clock.Now().Add(time.Hour); !timer.End().Equal(expected) {
+			t.Errorf("End after Resync = %v, expected %v", timer.End(), expected)
+		}
+
+		clock.Advance(time.Hour)
+		if timer.State() != StateFired {
+			t.Errorf("State = %s, expected %s", timer.State(), StateFired)
+		}
+	})
+
+	t.Run("Absolute", func(t *testing.T) {
+		clock := newFakeClock(testEpoch)
+		timer := NewIdleTimerWithClock(clock)
+		end := testEpoch.Add(time.Hour)
+		timer.ResetAt(end)
+
+		clock.Step(30 * time.Minute)
+		timer.Resync()
+		if !timer.End().Equal(end) {
+			t.Errorf("End after Resync = %v, expected %v", timer.End(), end)
+		}
+		if remaining := timer.TimeRemaining(); remaining != 30*time.Minute {
+			t.Errorf("TimeRemaining after Resync = %v, expected 30m", remaining)
+		}
+
+		clock.Advance(30 * time.Minute)
+		if timer.State() != StateFired {
+			t.Errorf("State = %s, expected %s", timer.State(), StateFired)
+		}
+	})
 }
 
 // TestTimerChannelReadOnly verifies C() returns read-only channel
@@ -0,0 +1,509 @@
+package main
+
+import (
+	"github.com/brutella/hap"
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/service"
+
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultTimerName is the timer served when no names are configured.
+// Its end time is persisted under timerStoreKey for compatibility.
+const defaultTimerName = "timer"
+
+// timerNamePattern restricts names to characters that are safe in URL paths,
+// file names and NVRAM variable names (which are limited to 64 characters).
+var timerNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// Accessory types representing a timer in HomeKit, see also output.go
+const (
+	accessorySwitch = "switch" // Switch turned on when the timer fires
+	accessoryValve  = "valve"  // Valve showing the countdown, closing when the timer fires
+)
+
+// Policies for turning the switch off in HomeKit
+const (
+	switchOffIgnore = "ignore" // Leave the countdown alone
+	switchOffCancel = "cancel" // Cancel the pending countdown
+	switchOffRearm  = "rearm"  // Restart the countdown with the default duration
+)
+
+// Policies for turning the switch on in HomeKit
+const (
+	switchOnIgnore = "ignore" // Leave the countdown alone
+	switchOnFire   = "fire"   // Count as a fire, cancelling the pending countdown
+	switchOnArm    = "arm"    // Arm the default duration and turn the switch back off
+)
+
+// timerConfig holds the options shared by all named timers.
+type timerConfig struct {
+	// Accessory is the accessory type representing each timer; empty means accessorySwitch.
+	Accessory string
+
+	// Pulse is how long the switch stays on after firing before it is turned
+	// off automatically. Zero latches the switch on until someone turns it off,
+	// or clears sensors after sensorPulse.
+	Pulse time.Duration
+
+	// SwitchOff and SwitchOn are the policies applied when the switch is
+	// turned off or on in HomeKit. DefaultDuration is the countdown armed by
+	// switchOffRearm and switchOnArm.
+	SwitchOff       string
+	SwitchOn        string
+	DefaultDuration time.Duration
+
+	// ArmedSensor adds an occupancy sensor to each timer's accessory that
+	// detects occupancy while the countdown is armed.
+	ArmedSensor bool
+
+	// Identity is the accessory information of the served accessory. The
+	// bridge, if any, gets all of it; bridged timers only get the
+	// manufacturer, model and firmware.
+	Identity accessoryIdentity
+
+	// Location is the time zone of local HH:MM times; nil means time.Local.
+	Location *time.Location
+
+	// Clock drives the countdowns and schedules; nil means the real clock.
+	Clock Clock
+
+	// Sync tracks whether Clock's wall time can be trusted. nil means a new
+	// clockSync using SyncCheck as its external sync indicator.
+	Sync      *clockSync
+	SyncCheck func() bool
+
+	// Events receives timer and switch changes for event streams; nil means
+	// a new eventHub.
+	Events *eventHub
+}
+
+// withDefaults fills in the clock, its sync tracking and the event hub if
+// they are unset.
+func (c timerConfig) withDefaults() timerConfig {
+	if c.Clock == nil {
+		c.Clock = realClock{}
+	}
+	if c.Sync == nil {
+		c.Sync = newClockSync(c.Clock, c.SyncCheck)
+	}
+	if c.Events == nil {
+		c.Events = newEventHub()
+	}
+	return c
+}
+
+// namedTimer is a SecondsTimer bound to its own HomeKit accessory.
+type namedTimer struct {
+	Name      string
+	Timer     *SecondsTimer
+	A         *accessory.A             // served accessory
+	Output    fireOutput               // shows the timer firing; nil for a valve
+	On        *characteristic.On       // switch or outlet state controlled in HomeKit; nil for other types
+	Valve     *timerValve              // nil unless the accessory is a valve
+	Armed     *service.OccupancySensor // nil unless timerConfig.ArmedSensor is set
+	Schedules *scheduler
+	config    timerConfig
+	clock     Clock
+	persister *timerPersister
+
+	mu    sync.Mutex // guards pulse
+	pulse ClockTimer // pending automatic switch off, see timerConfig.Pulse
+}
+
+// timerSet is the collection of named timers served by hktimer, in configured order.
+type timerSet struct {
+	timers   []*namedTimer
+	byName   map[string]*namedTimer
+	sync     *clockSync // shared by all timers
+	identity accessoryIdentity
+}
+
+// parseTimerNames splits a comma-separated list of timer names and validates them.
+func parseTimerNames(s string) ([]string, error) {
+	var names []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if !timerNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid timer name %q (use 1-32 letters, digits, '-' or '_')", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate timer name %q", name)
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// validAccessory reports whether typ is a known accessory type.
+func validAccessory(typ string) bool {
+	switch typ {
+	case accessorySwitch, accessoryValve, accessoryOutlet, accessoryButton,
+		accessoryContact, accessoryMotion, accessoryOccupancy:
+		return true
+	}
+	return false
+}
+
+// validSwitchOffPolicy reports whether policy is a known switch-off policy.
+func validSwitchOffPolicy(policy string) bool {
+	switch policy {
+	case switchOffIgnore, switchOffCancel, switchOffRearm:
+		return true
+	}
+	return false
+}
+
+// validSwitchOnPolicy reports whether policy is a known switch-on policy.
+func validSwitchOnPolicy(policy string) bool {
+	switch policy {
+	case switchOnIgnore, switchOnFire, switchOnArm:
+		return true
+	}
+	return false
+}
+
+// timerKey returns the hap.Store key holding the armed timer called name.
+func timerKey(name string) string {
+	if name == defaultTimerName {
+		return timerStoreKey
+	}
+	return timerStoreKey + "_" + name
+}
+
+// schedulesKey returns the hap.Store key holding the schedules of the timer called name.
+func schedulesKey(name string) string {
+	if name == defaultTimerName {
+		return schedulesStoreKey
+	}
+	return schedulesStoreKey + "_" + name
+}
+
+// accessoryID derives a stable HomeKit accessory id from a timer name, so
+// reordering the configured names doesn't reassign switches in the Home app.
+// Id 1 is reserved for the bridge.
+func accessoryID(name string) uint64 {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return uint64(h.Sum32()) + 2
+}
+
+// newTimerSet creates a named timer for each name.
+// Timers persist their end time in store.
+func newTimerSet(names []string, store hap.Store, config timerConfig) *timerSet {
+	config = config.withDefaults()
+	ts := &timerSet{byName: make(map[string]*namedTimer), sync: config.Sync, identity: config.Identity}
+	for _, name := range names {
+		nt := newNamedTimer(name, store, config)
+		ts.timers = append(ts.timers, nt)
+		ts.byName[name] = nt
+	}
+	return ts
+}
+
+// newNamedTimer creates an idle timer and its accessory.
+func newNamedTimer(name string, store hap.Store, config timerConfig) *namedTimer {
+	config = config.withDefaults()
+	nt := &namedTimer{
+		Name:      name,
+		Timer:     NewIdleTimerWithClock(config.Clock),
+		config:    config,
+		clock:     config.Clock,
+		persister: newTimerPersister(store, timerKey(name)),
+	}
+	nt.Schedules = newScheduler(store, schedulesKey(name), config.Location, config.Sync, nt.scheduled)
+
+	// Follow wall-clock steps, e.g. when NTP syncs after boot
+	config.Sync.OnStep(func() {
+		nt.Timer.Resync()
+		nt.Schedules.wake()
+	})
+
+	if config.Accessory == accessoryValve {
+		nt.Valve = newTimerValve(name, config.DefaultDuration)
+		nt.A = nt.Valve.A
+		nt.bindValve()
+	} else {
+		nt.A, nt.Output = newFireOutput(config.Accessory, name)
+		if o, ok := nt.Output.(onOutput); ok {
+			// Apply the switch policies when the switch is controlled through HomeKit
+			nt.On = o.On
+			nt.On.OnValueRemoteUpdate(nt.remoteSwitch)
+		}
+	}
+
+	if config.ArmedSensor {
+		nt.bindArmed()
+	}
+
+	// Publish every change to event stream clients. Output changes are
+	// published by setOutput and remoteSwitch, which know their source.
+	nt.Timer.OnChange(func(status TimerStatus) {
+		nt.publishTimer(string(status.State), status)
+	})
+	return nt
+}
+
+// All returns the timers in configured order.
+func (ts *timerSet) All() []*namedTimer {
+	return ts.timers
+}
+
+// Get returns the timer called name, or nil if there is none.
+func (ts *timerSet) Get(name string) *namedTimer {
+	return ts.byName[name]
+}
+
+// Accessories returns the accessories to serve: the switch itself for a single
+// timer, or a bridge followed by one switch per timer.
+func (ts *timerSet) Accessories() (*accessory.A, []*accessory.A, error) {
+	if len(ts.timers) == 1 {
+		a := ts.timers[0].A
+		a.Id = 1
+		ts.identity.apply(a)
+		return a, nil, nil
+	}
+
+	bridge := accessory.NewBridge(accessory.Info{
+		Name: "hktimer",
+	})
+	bridge.Id = 1
+	ts.identity.apply(bridge.A)
+
+	bridged := accessoryIdentity{
+		Manufacturer: ts.identity.Manufacturer,
+		Model:        ts.identity.Model,
+		Firmware:     ts.identity.Firmware,
+	}
+
+	var as []*accessory.A
+	ids := make(map[uint64]string)
+	for _, nt := range ts.timers {
+		a := nt.A
+		a.Id = accessoryID(nt.Name)
+		if other, ok := ids[a.Id]; ok {
+			return nil, nil, fmt.Errorf("timer names %q and %q map to the same accessory id", other, nt.Name)
+		}
+		ids[a.Id] = nt.Name
+		bridged.apply(a)
+		as = append(as, a)
+	}
+	return bridge.A, as, nil
+}
+
+// Restore tracks every timer's end time in the store, re-arms countdowns
+// that were pending when hktimer last stopped and loads the schedules.
+// Persisted end times are wall-clock times, so they are restored once the
+// clock is synced.
+func (ts *timerSet) Restore(policy string, grace time.Duration) {
+	if !ts.sync.Synced() {
+		log.Println("Clock not synced yet, waiting to restore timers")
+	}
+	for _, nt := range ts.timers {
+		nt.persister.Track(nt.Timer)
+		ts.sync.WhenSynced(func() {
+			if nt.Timer.State() != StateIdle {
+				// Set through the API in the meantime
+				return
+			}
+			if err := restoreTimer(nt.Timer, nt.persister, policy, grace); err != nil {
+				log.Printf("Failed to restore timer %s: %s", nt.Name, err)
+			}
+		})
+		if err := nt.Schedules.Load(); err != nil {
+			log.Printf("Failed to load schedules of timer %s: %s", nt.Name, err)
+		}
+	}
+}
+
+// Run waits for the timers to expire or their schedules to be due and turns
+// on their switches, while watching for wall-clock steps. It runs two
+// goroutines per timer and returns once all of them have stopped after ctx is
+// cancelled.
+func (ts *timerSet) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ts.sync.Run(ctx)
+	}()
+	for _, nt := range ts.timers {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			nt.run(ctx)
+		}()
+		go func() {
+			defer wg.Done()
+			nt.Schedules.Run(ctx)
+		}()
+	}
+	wg.Wait()
+	log.Println("Timer goroutines stopped")
+}
+
+// run turns on the switch every time the timer fires, until ctx is cancelled.
+func (nt *namedTimer) run(ctx context.Context) {
+	for {
+		select {
+		case <-nt.Timer.C():
+			// Timer expired - turn on the HomeKit switch
+			nt.switchOn(sourceTimer)
+		case <-ctx.Done():
+			// Shutdown requested - leave the timer armed so the persisted
+			// deadline is restored on the next start
+			nt.mu.Lock()
+			if nt.pulse != nil {
+				nt.pulse.Stop()
+			}
+			nt.mu.Unlock()
+			return
+		}
+	}
+}
+
+// remoteSwitch publishes the switch being turned on or off through HomeKit
+// and applies the configured policy.
+func (nt *namedTimer) remoteSwitch(on bool) {
+	nt.publishSwitch(sourceHomeKit)
+	t := nt.Timer.Via(sourceHomeKit)
+	if !on {
+		log.Printf("Switching %s off remotely", nt.Name)
+		switch nt.config.SwitchOff {
+		case switchOffCancel:
+			if t.Stop() {
+				log.Printf("Cancelled timer %s", nt.Name)
+			}
+		case switchOffRearm:
+			t.Reset(nt.config.DefaultDuration)
+			log.Printf("Set timer %s to %s", nt.Name, nt.config.DefaultDuration)
+		}
+		return
+	}
+
+	log.Printf("Switching %s on remotely", nt.Name)
+	switch nt.config.SwitchOn {
+	case switchOnFire:
+		t.Fire()
+		log.Printf("Fired timer %s remotely", nt.Name)
+		if nt.pulseDuration() > 0 {
+			nt.mu.Lock()
+			nt.pulseLocked()
+			nt.mu.Unlock()
+		}
+	case switchOnArm:
+		t.Reset(nt.config.DefaultDuration)
+		log.Printf("Set timer %s to %s", nt.Name, nt.config.DefaultDuration)
+		// Turn the switch back off so firing is a fresh off-on edge
+		nt.setOutput(false, sourceHomeKit)
+	}
+}
+
+// scheduled is called when one of the timer's schedules is due. It fires the
+// switch, or starts a valve for its duration like an irrigation schedule.
+func (nt *namedTimer) scheduled() {
+	if nt.Valve != nil {
+		d := nt.valveDuration()
+		log.Printf("Starting valve %s via schedule for %s", nt.Name, d)
+		nt.Timer.Via(sourceSchedule).Reset(d)
+		return
+	}
+	nt.switchOn(sourceSchedule)
+}
+
+// switchOn turns on the switch, or triggers the other output types, after the
+// timer or a schedule (source) fired. In pulse mode it is turned off again
+// after the pulse duration, and a switch that is still on from the previous
+// fire is turned off first so HomeKit sees a fresh edge. A valve has already
+// closed through syncValve.
+func (nt *namedTimer) switchOn(source string) {
+	if nt.Valve != nil {
+		log.Printf("Closed valve %s via %s", nt.Name, source)
+		return
+	}
+
+	out := nt.Output
+	if out.Momentary() {
+		log.Printf("Pressing %s via %s", nt.Name, source)
+		nt.setOutput(true, source)
+		return
+	}
+
+	pulse := nt.pulseDuration()
+	if pulse <= 0 {
+		log.Printf("Switching %s on via %s (latched until switched off)", nt.Name, source)
+		nt.setOutput(true, source)
+		return
+	}
+
+	nt.mu.Lock()
+	defer nt.mu.Unlock()
+	if out.Value() {
+		nt.setOutput(false, source)
+	}
+	log.Printf("Switching %s on via %s for %s", nt.Name, source, pulse)
+	nt.setOutput(true, source)
+	nt.pulseLocked()
+}
+
+// setOutput shows (true) or clears (false) the fire, publishing the change
+// as caused by source. Outputs that didn't change publish nothing, except
+// momentary ones, which change on every press.
+func (nt *namedTimer) setOutput(on bool, source string) {
+	out := nt.Output
+	if !out.Momentary() && out.Value() == on {
+		return
+	}
+	out.Set(on)
+	nt.publishSwitch(source)
+}
+
+// pulseDuration returns how long the output shows a fire, or 0 if it latches.
+func (nt *namedTimer) pulseDuration() time.Duration {
+	if nt.config.Pulse > 0 || nt.On != nil {
+		return nt.config.Pulse
+	}
+	return sensorPulse
+}
+
+// pulseLocked schedules turning the switch off after the pulse duration,
+// replacing a pending pulse. Callers must hold nt.mu.
+func (nt *namedTimer) pulseLocked() {
+	if nt.pulse != nil {
+		nt.pulse.Stop()
+	}
+
+	// The callback can't run before nt.pulse is set, as it needs nt.mu
+	var pulse ClockTimer
+	pulse = nt.clock.AfterFunc(nt.pulseDuration(), func() {
+		nt.mu.Lock()
+		defer nt.mu.Unlock()
+		if nt.pulse != pulse {
+			// Replaced by a later fire
+			return
+		}
+		nt.pulse = nil
+		log.Printf("Switching %s off after pulse", nt.Name)
+		nt.setOutput(false, sourceTimer)
+	})
+	nt.pulse = pulse
+}
+
+// Latched reports whether the switch is currently on, or a sensor reports a
+// fire. Valves and buttons never latch.
+func (nt *namedTimer) Latched() bool {
+	if nt.Output == nil {
+		return false
+	}
+	return nt.Output.Value()
+}
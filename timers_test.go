@@ -0,0 +1,321 @@
+package main
+
+import (
+	"github.com/brutella/hap"
+
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestParseTimerNames verifies name splitting and validation
+func TestParseTimerNames(t *testing.T) {
+	names, err := parseTimerNames("kids, guest_wifi,lights-off")
+	if err != nil {
+		t.Fatalf("parseTimerNames failed: %v", err)
+	}
+	expected := []string{"kids", "guest_wifi", "lights-off"}
+	if len(names) != len(expected) {
+		t.Fatalf("Names = %v, expected %v", names, expected)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Errorf("Name #%d = %q, expected %q", i, names[i], expected[i])
+		}
+	}
+
+	invalid := []string{"", "a,,b", "a/b", "a b", "a,a", "abcdefghijklmnopqrstuvwxyz0123456"}
+	for _, s := range invalid {
+		if _, err := parseTimerNames(s); err == nil {
+			t.Errorf("parseTimerNames(%q) succeeded, expected error", s)
+		}
+	}
+}
+
+// TestTimerKey verifies the default timer keeps the original store key
+func TestTimerKey(t *testing.T) {
+	if key := timerKey(defaultTimerName); key != timerStoreKey {
+		t.Errorf("timerKey(%q) = %q, expected %q", defaultTimerName, key, timerStoreKey)
+	}
+	if key := timerKey("kids"); key != "timer_kids" {
+		t.Errorf("timerKey(\"kids\") = %q, expected \"timer_kids\"", key)
+	}
+	if key := schedulesKey(defaultTimerName); key != schedulesStoreKey {
+		t.Errorf("schedulesKey(%q) = %q, expected %q", defaultTimerName, key, schedulesStoreKey)
+	}
+	if key := schedulesKey("kids"); key != "schedules_kids" {
+		t.Errorf("schedulesKey(\"kids\") = %q, expected \"schedules_kids\"", key)
+	}
+}
+
+// TestTimerSetAccessoriesSingle verifies a single timer is served as a plain switch
+func TestTimerSetAccessoriesSingle(t *testing.T) {
+	ts := newTimerSet([]string{defaultTimerName}, hap.NewMemStore(), timerConfig{})
+
+	a, as, err := ts.Accessories()
+	if err != nil {
+		t.Fatalf("Accessories failed: %v", err)
+	}
+	if a != ts.Get(defaultTimerName).A || len(as) != 0 {
+		t.Error("Single timer should be served as its switch without a bridge")
+	}
+	if a.Id != 1 {
+		t.Errorf("Accessory id = %d, expected 1", a.Id)
+	}
+}
+
+// TestTimerSetAccessoriesBridge verifies several timers are bridged with stable ids
+func TestTimerSetAccessoriesBridge(t *testing.T) {
+	ts := newTimerSet([]string{"a", "b"}, hap.NewMemStore(), timerConfig{})
+
+	bridge, as, err := ts.Accessories()
+	if err != nil {
+		t.Fatalf("Accessories failed: %v", err)
+	}
+	if bridge.Id != 1 || len(as) != 2 {
+		t.Fatalf("Expected bridge with id 1 and 2 switches, got id %d and %d switches", bridge.Id, len(as))
+	}
+
+	// Ids only depend on the name, not the order
+	reordered := newTimerSet([]string{"b", "a"}, hap.NewMemStore(), timerConfig{})
+	_, ras, _ := reordered.Accessories()
+	if as[0].Id != ras[1].Id || as[1].Id != ras[0].Id {
+		t.Error("Accessory ids changed when timer names were reordered")
+	}
+	if as[0].Id == 1 || as[0].Id == as[1].Id {
+		t.Errorf("Accessory ids not unique: %d, %d", as[0].Id, as[1].Id)
+	}
+}
+
+// TestTimerSetGet verifies lookup by name
+func TestTimerSetGet(t *testing.T) {
+	ts := newTimerSet([]string{"a", "b"}, hap.NewMemStore(), timerConfig{})
+
+	if nt := ts.Get("b"); nt == nil || nt.Name != "b" {
+		t.Errorf("Get(\"b\") = %v, expected timer b", nt)
+	}
+	if nt := ts.Get("c"); nt != nil {
+		t.Errorf("Get(\"c\") = %v, expected nil", nt)
+	}
+}
+
+// TestTimerSetRun verifies each timer turns on its own switch and Run stops with the context
+func TestTimerSetRun(t *testing.T) {
+	store := hap.NewMemStore()
+	ts := newTimerSet([]string{"a", "b"}, store, timerConfig{})
+	ts.Restore(missedSkip, 0)
+
+	// Callbacks run in registration order, so this one runs after the persister's
+	fired := make(chan struct{})
+	ts.Get("b").Timer.OnChange(func(status TimerStatus) {
+		if status.State == StateFired {
+			close(fired)
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		ts.Run(ctx)
+		close(done)
+	}()
+
+	ts.Get("b").Timer.Reset(0)
+
+	deadline := time.Now().Add(time.Second)
+	for !ts.Get("b").On.Value() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !ts.Get("b").On.Value() {
+		t.Error("Switch b not turned on after its timer fired")
+	}
+	if ts.Get("a").On.Value() {
+		t.Error("Switch a turned on by timer b")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after context was cancelled")
+	}
+
+	// The store is only safe to read once the timer goroutines have stopped
+	// and the fire has been persisted
+	<-fired
+	if _, err := store.Get(timerKey("b")); err == nil {
+		t.Error("Persisted timer b not cleared after firing")
+	}
+}
+
+// TestTimerSetRestoreWaitsForSync verifies persisted deadlines are restored once the clock is synced
+func TestTimerSetRestoreWaitsForSync(t *testing.T) {
+	store := hap.NewMemStore()
+	newTimerPersister(store, timerKey(defaultTimerName)).Save(TimerStatus{State: StateArmed, End: testEpoch.Add(time.Hour)})
+
+	clock := newFakeClock(time.Date(1970, 1, 1, 0, 0, 30, 0, time.UTC))
+	ts := newTimerSet([]string{defaultTimerName}, store, timerConfig{Clock: clock})
+	nt := ts.Get(defaultTimerName)
+
+	ts.Restore(missedSkip, 0)
+	if state := nt.Timer.State(); state != StateIdle {
+		t.Fatalf("State before sync = %s, expected %s", state, StateIdle)
+	}
+
+	// NTP sync steps the clock forward
+	clock.Step(testEpoch.Sub(clock.Now()))
+	ts.sync.Check()
+
+	if remaining := nt.Timer.TimeRemaining(); remaining != time.Hour {
+		t.Errorf("TimeRemaining after sync = %v, expected 1h", remaining)
+	}
+}
+
+// TestNamedTimerLatch verifies the switch stays on without a pulse duration
+func TestNamedTimerLatch(t *testing.T) {
+	clock := newFakeClock(testEpoch)
+	nt := newNamedTimer(defaultTimerName, hap.NewMemStore(), timerConfig{Clock: clock})
+
+	nt.switchOn("timer")
+	clock.Advance(time.Hour)
+
+	if !nt.Latched() {
+		t.Error("Switch turned off without pulse mode")
+	}
+}
+
+// TestNamedTimerPulse verifies the switch turns off again after the pulse duration
+func TestNamedTimerPulse(t *testing.T) {
+	clock := newFakeClock(testEpoch)
+	nt := newNamedTimer(defaultTimerName, hap.NewMemStore(), timerConfig{Pulse: time.Second, Clock: clock})
+
+	var edges []bool
+	nt.On.OnValueUpdate(func(new, old bool, req *http.Request) {
+		edges = append(edges, new)
+	})
+
+	nt.switchOn("timer")
+	if !nt.Latched() {
+		t.Fatal("Switch not on after firing")
+	}
+
+	// Firing again while on produces a fresh off-on edge and restarts the pulse
+	clock.Advance(500 * time.Millisecond)
+	nt.switchOn("timer")
+
+	clock.Advance(900 * time.Millisecond)
+	if !nt.Latched() {
+		t.Error("Switch turned off by the replaced pulse")
+	}
+	clock.Advance(100 * time.Millisecond)
+	if nt.Latched() {
+		t.Error("Switch still on after pulse duration")
+	}
+
+	expected := []bool{true, false, true, false}
+	if len(edges) != len(expected) {
+		t.Fatalf("Switch changes = %v, expected %v", edges, expected)
+	}
+	for i := range expected {
+		if edges[i] != expected[i] {
+			t.Errorf("Switch changes = %v, expected %v", edges, expected)
+			break
+		}
+	}
+}
+
+// TestNamedTimerSwitchPolicies verifies HomeKit switch changes drive the countdown
+func TestNamedTimerSwitchPolicies(t *testing.T) {
+	testCases := []struct {
+		name     string
+		config   timerConfig
+		on       bool
+		state    TimerState
+		remain   time.Duration
+		switchOn bool
+	}{
+		{"Off ignore", timerConfig{SwitchOff: switchOffIgnore}, false, StateArmed, time.Hour, false},
+		{"Off cancel", timerConfig{SwitchOff: switchOffCancel}, false, StateCancelled, 0, false},
+		{"Off rearm", timerConfig{SwitchOff: switchOffRearm, DefaultDuration: time.Minute}, false, StateArmed, time.Minute, false},
+		{"On ignore", timerConfig{SwitchOn: switchOnIgnore}, true, StateArmed, time.Hour, true},
+		{"On fire", timerConfig{SwitchOn: switchOnFire}, true, StateFired, 0, true},
+		{"On arm", timerConfig{SwitchOn: switchOnArm, DefaultDuration: time.Minute}, true, StateArmed, time.Minute, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.config.Clock = newFakeClock(testEpoch)
+			nt := newNamedTimer(defaultTimerName, hap.NewMemStore(), tc.config)
+			nt.Timer.Reset(time.Hour)
+
+			// Start from the opposite switch state, then change it like a controller would
+			nt.On.SetValue(!tc.on)
+			nt.On.SetValueRequest(tc.on, httptest.NewRequest(http.MethodPut, "/characteristics", nil))
+
+			st := nt.Timer.Status()
+			if st.State != tc.state {
+				t.Errorf("State = %s, expected %s", st.State, tc.state)
+			}
+			if remaining := st.Remaining(); remaining != tc.remain {
+				t.Errorf("Remaining = %v, expected %v", remaining, tc.remain)
+			}
+			if nt.Latched() != tc.switchOn {
+				t.Errorf("Switch on = %v, expected %v", nt.Latched(), tc.switchOn)
+			}
+		})
+	}
+}
+
+// TestNamedTimerSwitchOnFirePulse verifies a manual fire is also reset in pulse mode
+func TestNamedTimerSwitchOnFirePulse(t *testing.T) {
+	store := hap.NewMemStore()
+	clock := newFakeClock(testEpoch)
+	nt := newNamedTimer(defaultTimerName, store, timerConfig{SwitchOn: switchOnFire, Pulse: time.Second, Clock: clock})
+	nt.persister.Track(nt.Timer)
+	nt.Timer.Reset(time.Hour)
+
+	nt.On.SetValueRequest(true, httptest.NewRequest(http.MethodPut, "/characteristics", nil))
+
+	if st := nt.Timer.Status(); st.LastFired.IsZero() {
+		t.Error("Manual switch on not recorded as fire")
+	}
+	if _, err := store.Get(timerKey(defaultTimerName)); err == nil {
+		t.Error("Persisted timer not cleared by manual fire")
+	}
+
+	clock.Advance(time.Second)
+	if nt.Latched() {
+		t.Error("Switch still on after pulse duration")
+	}
+}
+
+// TestValidAccessory verifies accessory type validation
+func TestValidAccessory(t *testing.T) {
+	for _, typ := range []string{accessorySwitch, accessoryValve, accessoryOutlet, accessoryButton, accessoryContact, accessoryMotion, accessoryOccupancy} {
+		if !validAccessory(typ) {
+			t.Errorf("validAccessory(%q) = false, expected true", typ)
+		}
+	}
+	if validAccessory("lock") {
+		t.Error("validAccessory(\"lock\") = true, expected false")
+	}
+}
+
+// TestValidSwitchPolicies verifies switch policy name validation
+func TestValidSwitchPolicies(t *testing.T) {
+	for _, policy := range []string{switchOffIgnore, switchOffCancel, switchOffRearm} {
+		if !validSwitchOffPolicy(policy) {
+			t.Errorf("validSwitchOffPolicy(%q) = false, expected true", policy)
+		}
+	}
+	for _, policy := range []string{switchOnIgnore, switchOnFire, switchOnArm} {
+		if !validSwitchOnPolicy(policy) {
+			t.Errorf("validSwitchOnPolicy(%q) = false, expected true", policy)
+		}
+	}
+	if validSwitchOffPolicy(switchOnFire) || validSwitchOnPolicy(switchOffCancel) {
+		t.Error("Switch policies accepted for the wrong direction")
+	}
+}
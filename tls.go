@@ -0,0 +1,147 @@
+package main
+
+import (
+	"github.com/brutella/hap"
+
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+)
+
+// hap.Store keys of the self-signed API certificate and its private key,
+// stored as base64 DER so they fit in a single NVRAM variable each
+const (
+	tlsCertKey = "api_cert"
+	tlsKeyKey  = "api_key"
+)
+
+// selfSignedNotAfter is the expiry of self-signed certificates: none, as
+// RFC 5280 recommends for certificates without a well-defined expiry. Clients
+// pin them, and one made while the clock is still in 1970 stays usable.
+var selfSignedNotAfter = time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC)
+
+// apiCertificate returns the certificate of the API listener: the one in
+// certFile and keyFile if given, or else the self-signed one in store.
+func apiCertificate(certFile, keyFile string, store hap.Store) (tls.Certificate, error) {
+	if certFile != "" {
+		return tls.LoadX509KeyPair(certFile, keyFile)
+	}
+	return selfSignedCertificate(store)
+}
+
+// apiTLSConfig returns the TLS configuration of the API listener for cert.
+func apiTLSConfig(cert tls.Certificate) *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
+// selfSignedCertificate returns the self-signed certificate in store,
+// generating and storing one on first use.
+func selfSignedCertificate(store hap.Store) (tls.Certificate, error) {
+	cert, err := loadStoredCertificate(store)
+	if err == nil {
+		return cert, nil
+	}
+	if b, _ := store.Get(tlsCertKey); len(b) > 0 {
+		log.Printf("Stored API certificate unusable, generating a new one: %s", err)
+	}
+
+	certDER, keyDER, err := generateCertificate()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := store.Set(tlsKeyKey, []byte(base64.StdEncoding.EncodeToString(keyDER))); err != nil {
+		return tls.Certificate{}, fmt.Errorf("store key: %w", err)
+	}
+	if err := store.Set(tlsCertKey, []byte(base64.StdEncoding.EncodeToString(certDER))); err != nil {
+		return tls.Certificate{}, fmt.Errorf("store certificate: %w", err)
+	}
+	log.Println("Generated a self-signed API certificate")
+	return loadStoredCertificate(store)
+}
+
+// loadStoredCertificate reads the certificate and key from store.
+func loadStoredCertificate(store hap.Store) (tls.Certificate, error) {
+	var der [2][]byte
+	for i, key := range []string{tlsCertKey, tlsKeyKey} {
+		b, err := store.Get(key)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+		if der[i], err = base64.StdEncoding.DecodeString(string(b)); err != nil {
+			return tls.Certificate{}, fmt.Errorf("decode %s: %w", key, err)
+		}
+	}
+
+	leaf, err := x509.ParseCertificate(der[0])
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der[1])
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if pub, isKey := leaf.PublicKey.(interface{ Equal(crypto.PublicKey) bool }); !ok || !isKey || !pub.Equal(signer.Public()) {
+		return tls.Certificate{}, fmt.Errorf("key doesn't match the certificate")
+	}
+	return tls.Certificate{Certificate: [][]byte{der[0]}, PrivateKey: key, Leaf: leaf}, nil
+}
+
+// generateCertificate creates a self-signed ECDSA P-256 certificate for
+// hktimer, returning it and its PKCS #8 private key in DER.
+func generateCertificate() (certDER, keyDER []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "hktimer"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              selfSignedNotAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"hktimer", "localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	certDER, err = x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err = x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return certDER, keyDER, nil
+}
+
+// certFingerprint returns the SHA-256 fingerprint of the leaf certificate of
+// cert, in the colon-separated form shown by openssl and browsers.
+func certFingerprint(cert tls.Certificate) string {
+	sum := sha256.Sum256(cert.Certificate[0])
+	hex := make([]string, len(sum))
+	for i, b := range sum {
+		hex[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(hex, ":")
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"github.com/brutella/hap"
+
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+// TestSelfSignedCertificate verifies the certificate is generated once and kept in the store
+func TestSelfSignedCertificate(t *testing.T) {
+	store := hap.NewMemStore()
+	cert, err := selfSignedCertificate(store)
+	if err != nil {
+		t.Fatalf("selfSignedCertificate failed: %v", err)
+	}
+	if cert.Leaf.Subject.CommonName != "hktimer" || !cert.Leaf.NotAfter.Equal(selfSignedNotAfter) {
+		t.Errorf("Certificate for %s until %s", cert.Leaf.Subject.CommonName, cert.Leaf.NotAfter)
+	}
+
+	again, err := selfSignedCertificate(store)
+	if err != nil {
+		t.Fatalf("selfSignedCertificate failed the second time: %v", err)
+	}
+	if certFingerprint(again) != certFingerprint(cert) {
+		t.Error("Stored certificate not reused")
+	}
+
+	// A damaged certificate is replaced
+	store.Set(tlsCertKey, []byte("garbage"))
+	replaced, err := selfSignedCertificate(store)
+	if err != nil {
+		t.Fatalf("selfSignedCertificate failed with a damaged certificate: %v", err)
+	}
+	if certFingerprint(replaced) == certFingerprint(cert) {
+		t.Error("Damaged certificate not replaced")
+	}
+}
+
+// TestLoadStoredCertificateMismatch verifies a key of another certificate is rejected
+func TestLoadStoredCertificateMismatch(t *testing.T) {
+	store := hap.NewMemStore()
+	selfSignedCertificate(store)
+	other := hap.NewMemStore()
+	selfSignedCertificate(other)
+	key, _ := other.Get(tlsKeyKey)
+	store.Set(tlsKeyKey, key)
+
+	if _, err := loadStoredCertificate(store); err == nil {
+		t.Error("loadStoredCertificate accepted a key of another certificate")
+	}
+}
+
+// TestCertFingerprint verifies the fingerprint format
+func TestCertFingerprint(t *testing.T) {
+	cert, _ := selfSignedCertificate(hap.NewMemStore())
+	if fp := certFingerprint(cert); !regexp.MustCompile(`^([0-9A-F]{2}:){31}[0-9A-F]{2}$`).MatchString(fp) {
+		t.Errorf("Fingerprint %q not in colon-separated hex", fp)
+	}
+}
+
+// TestAPICertificateFiles verifies operator-supplied PEM files are used over the store
+func TestAPICertificateFiles(t *testing.T) {
+	certDER, keyDER, err := generateCertificate()
+	if err != nil {
+		t.Fatalf("generateCertificate failed: %v", err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600)
+
+	store := hap.NewMemStore()
+	cert, err := apiCertificate(certFile, keyFile, store)
+	if err != nil {
+		t.Fatalf("apiCertificate failed: %v", err)
+	}
+	if string(cert.Certificate[0]) != string(certDER) {
+		t.Error("Certificate not loaded from the file")
+	}
+	if _, err := store.Get(tlsCertKey); err == nil {
+		t.Error("Self-signed certificate stored although files were given")
+	}
+	if _, err := apiCertificate(certFile, filepath.Join(dir, "missing.pem"), store); err == nil {
+		t.Error("apiCertificate succeeded without a key file")
+	}
+}
+
+// TestServeAPITLS verifies clients pinning the certificate can use the API over TLS
+func TestServeAPITLS(t *testing.T) {
+	cert, _ := selfSignedCertificate(hap.NewMemStore())
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	ln = tls.NewListener(ln, apiTLSConfig(cert))
+
+	mux := newAPIMux()
+	mux.HandleFunc("/timer", timerHandler(newNamedTimer(defaultTimerName, hap.NewMemStore(), timerConfig{})))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		serveAPI(ctx, ln, mux)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert.Leaf)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	res, err := client.Get("https://" + ln.Addr().String() + "/timer")
+	if err != nil {
+		t.Fatalf("GET over TLS failed: %v", err)
+	}
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("GET returned status %d", res.StatusCode)
+	}
+
+	// Plain HTTP is refused
+	if res, err := http.Get("http://" + ln.Addr().String() + "/timer"); err == nil {
+		if res.StatusCode == http.StatusOK {
+			t.Error("Plain HTTP request served")
+		}
+		res.Body.Close()
+	}
+}
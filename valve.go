@@ -0,0 +1,115 @@
+package main
+
+import (
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/service"
+
+	"log"
+	"math"
+	"net/http"
+	"time"
+)
+
+// timerValve is a HomeKit valve showing a timer's countdown. The Home app
+// lets users pick SetDuration, start and cancel the valve, and counts down
+// RemainingDuration while it is in use.
+type timerValve struct {
+	*accessory.A
+	Valve             *service.Valve
+	SetDuration       *characteristic.SetDuration
+	RemainingDuration *characteristic.RemainingDuration
+}
+
+// newTimerValve creates a valve accessory whose duration defaults to d.
+func newTimerValve(name string, d time.Duration) *timerValve {
+	v := &timerValve{}
+	v.A = accessory.New(accessory.Info{
+		Name: name,
+	}, accessory.TypeOther)
+
+	v.Valve = service.NewValve()
+	v.Valve.ValveType.SetValue(characteristic.ValveTypeGenericValve)
+
+	// HAP limits both durations to an hour. Countdowns set over HTTP can be
+	// longer, so their remaining time is reported as an hour until the last
+	// hour, see remainingSeconds.
+	v.SetDuration = characteristic.NewSetDuration()
+	v.SetDuration.SetValue(min(int(d.Seconds()), v.SetDuration.MaxValue()))
+	v.Valve.AddC(v.SetDuration.C)
+
+	v.RemainingDuration = characteristic.NewRemainingDuration()
+	v.Valve.AddC(v.RemainingDuration.C)
+
+	v.AddS(v.Valve.S)
+	return v
+}
+
+// bindValve connects the valve to the timer: starting or stopping the valve
+// in HomeKit arms or cancels the countdown, and every change of the timer,
+// including over HTTP, updates the valve.
+func (nt *namedTimer) bindValve() {
+	v := nt.Valve
+	v.Valve.Active.OnValueRemoteUpdate(func(active int) {
+		nt.remoteValve(active)
+	})
+
+	// Report the live remaining time, as controllers read it at any point
+	v.RemainingDuration.ValueRequestFunc = func(*http.Request) (interface{}, int) {
+		return v.remainingSeconds(nt.Timer.TimeRemaining()), 0
+	}
+
+	nt.Timer.OnChange(nt.syncValve)
+}
+
+// remoteValve arms or cancels the countdown after the valve was started or
+// stopped through HomeKit. Starting a paused countdown resumes it.
+func (nt *namedTimer) remoteValve(active int) {
+	t := nt.Timer.Via(sourceHomeKit)
+	if active != characteristic.ActiveActive {
+		log.Printf("Stopping valve %s remotely", nt.Name)
+		if t.Stop() {
+			log.Printf("Cancelled timer %s", nt.Name)
+		}
+		return
+	}
+
+	log.Printf("Starting valve %s remotely", nt.Name)
+	if t.Resume() == nil {
+		log.Printf("Resumed timer %s", nt.Name)
+		return
+	}
+	d := nt.valveDuration()
+	t.Reset(d)
+	log.Printf("Set timer %s to %s", nt.Name, d)
+}
+
+// valveDuration returns the duration chosen in the Home app, or the default
+// duration if none was chosen.
+func (nt *namedTimer) valveDuration() time.Duration {
+	if s := nt.Valve.SetDuration.Value(); s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	return nt.config.DefaultDuration
+}
+
+// syncValve updates the valve to the timer status: active and in use while
+// armed, with the remaining time, and inactive otherwise.
+func (nt *namedTimer) syncValve(status TimerStatus) {
+	v := nt.Valve
+	if status.State != StateArmed {
+		v.Valve.Active.SetValue(characteristic.ActiveInactive)
+		v.Valve.InUse.SetValue(characteristic.InUseNotInUse)
+		v.RemainingDuration.SetValue(0)
+		return
+	}
+	v.Valve.Active.SetValue(characteristic.ActiveActive)
+	v.Valve.InUse.SetValue(characteristic.InUseInUse)
+	v.RemainingDuration.SetValue(v.remainingSeconds(status.Left))
+}
+
+// remainingSeconds converts d to whole seconds for RemainingDuration,
+// clamped to the characteristic's maximum.
+func (v *timerValve) remainingSeconds(d time.Duration) int {
+	return min(int(math.Round(d.Seconds())), v.RemainingDuration.MaxValue())
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"github.com/brutella/hap"
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/service"
+
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestValve creates a valve timer on a fake clock
+func newTestValve() (*namedTimer, *fakeClock) {
+	clock := newFakeClock(testEpoch)
+	nt := newNamedTimer(defaultTimerName, hap.NewMemStore(), timerConfig{
+		Accessory:       accessoryValve,
+		DefaultDuration: 5 * time.Minute,
+		Clock:           clock,
+	})
+	return nt, clock
+}
+
+// remoteRequest is a characteristic write from a HomeKit controller
+func remoteRequest() *http.Request {
+	return httptest.NewRequest(http.MethodPut, "/characteristics", nil)
+}
+
+// TestTimerValveAccessory verifies the valve accessory exposes the duration characteristics
+func TestTimerValveAccessory(t *testing.T) {
+	nt, _ := newTestValve()
+
+	if nt.Output != nil {
+		t.Error("Valve timer has a fire output")
+	}
+	var valve bool
+	for _, s := range nt.A.Ss {
+		if s.Type == service.TypeValve {
+			valve = s.C(characteristic.TypeSetDuration) != nil && s.C(characteristic.TypeRemainingDuration) != nil
+		}
+	}
+	if !valve {
+		t.Error("Accessory has no valve service with SetDuration and RemainingDuration")
+	}
+	if d := nt.Valve.SetDuration.Value(); d != 300 {
+		t.Errorf("SetDuration = %d, expected default duration 300", d)
+	}
+}
+
+// TestTimerValveFollowsTimer verifies timer changes from other sources update the valve
+func TestTimerValveFollowsTimer(t *testing.T) {
+	nt, clock := newTestValve()
+	v := nt.Valve
+
+	nt.Timer.Reset(10 * time.Minute)
+	if v.Valve.Active.Value() != characteristic.ActiveActive || v.Valve.InUse.Value() != characteristic.InUseInUse {
+		t.Error("Valve not active and in use while armed")
+	}
+	if remaining := v.RemainingDuration.Value(); remaining != 600 {
+		t.Errorf("RemainingDuration = %d, expected 600", remaining)
+	}
+
+	// Controllers read the live remaining time
+	clock.Advance(30 * time.Second)
+	if value, _ := v.RemainingDuration.ValueRequest(remoteRequest()); value != 570 {
+		t.Errorf("RemainingDuration read = %v, expected 570", value)
+	}
+
+	clock.Advance(10 * time.Minute)
+	if v.Valve.Active.Value() != characteristic.ActiveInactive || v.Valve.InUse.Value() != characteristic.InUseNotInUse {
+		t.Error("Valve still active after the timer fired")
+	}
+	if remaining := v.RemainingDuration.Value(); remaining != 0 {
+		t.Errorf("RemainingDuration after firing = %d, expected 0", remaining)
+	}
+	if nt.Latched() {
+		t.Error("Valve reported as latched")
+	}
+}
+
+// TestTimerValveLong verifies countdowns over an hour report the HAP maximum
+func TestTimerValveLong(t *testing.T) {
+	nt, clock := newTestValve()
+	v := nt.Valve
+
+	if limit := v.RemainingDuration.MaxValue(); limit != 3600 {
+		t.Errorf("RemainingDuration maximum = %d, expected 3600", limit)
+	}
+
+	nt.Timer.Reset(3 * time.Hour)
+	if remaining := v.RemainingDuration.Value(); remaining != 3600 {
+		t.Errorf("RemainingDuration = %d, expected 3600", remaining)
+	}
+	if value, _ := v.RemainingDuration.ValueRequest(remoteRequest()); value != 3600 {
+		t.Errorf("RemainingDuration read = %v, expected 3600", value)
+	}
+
+	clock.Advance(150 * time.Minute)
+	if value, _ := v.RemainingDuration.ValueRequest(remoteRequest()); value != 1800 {
+		t.Errorf("RemainingDuration read in the last hour = %v, expected 1800", value)
+	}
+}
+
+// TestTimerValveRemote verifies starting and stopping the valve in HomeKit drives the timer
+func TestTimerValveRemote(t *testing.T) {
+	nt, _ := newTestValve()
+	v := nt.Valve
+
+	v.SetDuration.SetValueRequest(120, remoteRequest())
+	v.Valve.Active.SetValueRequest(characteristic.ActiveActive, remoteRequest())
+	if remaining := nt.Timer.TimeRemaining(); remaining != 2*time.Minute {
+		t.Errorf("TimeRemaining after start = %v, expected 2m", remaining)
+	}
+
+	// A paused countdown shows as inactive and resumes on start
+	nt.Timer.Pause()
+	if v.Valve.Active.Value() != characteristic.ActiveInactive {
+		t.Error("Valve active while paused")
+	}
+	v.Valve.Active.SetValueRequest(characteristic.ActiveActive, remoteRequest())
+	if st := nt.Timer.Status(); st.State != StateArmed || st.Left != 2*time.Minute {
+		t.Errorf("Status after start = %+v, expected resumed with 2m", st)
+	}
+
+	v.Valve.Active.SetValueRequest(characteristic.ActiveInactive, remoteRequest())
+	if state := nt.Timer.State(); state != StateCancelled {
+		t.Errorf("State after stop = %s, expected %s", state, StateCancelled)
+	}
+
+	// Without a chosen duration the default duration is used
+	v.SetDuration.SetValueRequest(0, remoteRequest())
+	v.Valve.Active.SetValueRequest(characteristic.ActiveActive, remoteRequest())
+	if remaining := nt.Timer.TimeRemaining(); remaining != 5*time.Minute {
+		t.Errorf("TimeRemaining with default duration = %v, expected 5m", remaining)
+	}
+}
+
+// TestTimerValveScheduled verifies a schedule starts the valve for its duration
+func TestTimerValveScheduled(t *testing.T) {
+	nt, _ := newTestValve()
+
+	nt.scheduled()
+
+	if remaining := nt.Timer.TimeRemaining(); remaining != 5*time.Minute {
+		t.Errorf("TimeRemaining after schedule = %v, expected 5m", remaining)
+	}
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"github.com/brutella/hap"
+
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Webhook defaults, used when the configuration leaves them out
+const (
+	defaultWebhookMethod  = http.MethodPost
+	defaultWebhookTimeout = 10 * time.Second
+	defaultWebhookRetries = 3
+	webhookQueueSize      = 32 // Events queued per webhook before new ones are dropped
+)
+
+// Headers of signed webhook requests
+const (
+	webhookTimestampHeader = "X-Hktimer-Timestamp"
+	webhookSignatureHeader = "X-Hktimer-Signature"
+)
+
+// Retry backoff, variables so tests can shorten them. The delay doubles after
+// every failed attempt, up to webhookMaxBackoff.
+var (
+	webhookBackoff    = time.Second
+	webhookMaxBackoff = time.Minute
+)
+
+// webhookEvents are the event types webhooks and the exec hook can subscribe to.
+var webhookEvents = map[string]bool{
+	string(StateFired):     true,
+	string(StateArmed):     true,
+	string(StateCancelled): true,
+	string(StatePaused):    true,
+	pairingPaired:          true,
+	pairingUnpaired:        true,
+}
+
+// webhookConfig is one webhook in the JSON file given with -webhooks.
+type webhookConfig struct {
+	URL     string            `json:"url"`               // http or https URL to call
+	Method  string            `json:"method,omitempty"`  // HTTP method; default POST
+	Headers map[string]string `json:"headers,omitempty"` // Extra request headers
+	Body    string            `json:"body,omitempty"`    // text/template of the body; default JSON of the event
+	Events  []string          `json:"events,omitempty"`  // Event types to send; default fired
+	Timers  []string          `json:"timers,omitempty"`  // Timer names to send events of; default all
+	Secret  string            `json:"secret,omitempty"`  // Key of the HMAC-SHA256 signature; unsigned if empty
+	Timeout string            `json:"timeout,omitempty"` // Timeout per attempt, e.g. 5s; default 10s
+	Retries *int              `json:"retries,omitempty"` // Retries after a failed attempt; default 3
+}
+
+// webhookPayload is the data of body templates, and the default body.
+type webhookPayload struct {
+	Event string      `json:"event"`           // Event type
+	Timer string      `json:"timer,omitempty"` // Timer name; empty for pairing events
+	Time  string      `json:"time"`            // ISO8601 timestamp of the event
+	Data  interface{} `json:"data"`            // Timer status as in GET /timer, or the pairing
+}
+
+// webhook is a validated webhookConfig with its delivery queue and status.
+type webhook struct {
+	config  webhookConfig
+	name    string             // URL without query and credentials, for logs and status
+	body    *template.Template // nil for the default body
+	timeout time.Duration
+	retries int
+	events  map[string]bool
+	timers  map[string]bool // nil for all timers
+	queue   chan webhookPayload
+
+	mu          sync.Mutex // guards the delivery status below
+	delivered   int
+	failed      int
+	lastSuccess time.Time
+	lastFailure time.Time
+	lastError   string
+}
+
+// webhookSet delivers events to the configured webhooks, each in the order
+// of the events and independently of the others.
+type webhookSet struct {
+	hooks  []*webhook
+	client *http.Client
+}
+
+// outputWebhook represents one webhook in the JSON response for GET /webhooks.
+type outputWebhook struct {
+	URL         string   `json:"url"`          // URL without query and credentials
+	Events      []string `json:"events"`       // Event types sent
+	Delivered   int      `json:"delivered"`    // Events delivered
+	Failed      int      `json:"failed"`       // Events given up on after all retries, or dropped
+	LastSuccess *string  `json:"last_success"` // ISO8601 timestamp of the last delivery, null if none
+	LastFailure *string  `json:"last_failure"` // ISO8601 timestamp of the last failure, null if none
+	LastError   *string  `json:"last_error"`   // Error of the last failure, null if none
+}
+
+// loadWebhooks reads the webhook configuration from the JSON file at path.
+func loadWebhooks(path string) ([]webhookConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var configs []webhookConfig
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&configs); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return configs, nil
+}
+
+// newWebhook validates config and fills in the defaults.
+func newWebhook(config webhookConfig) (*webhook, error) {
+	u, err := url.Parse(config.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid webhook url %q", config.URL)
+	}
+
+	// Leave out credentials that may be part of the URL
+	u.User, u.RawQuery, u.Fragment = nil, "", ""
+
+	h := &webhook{
+		config:  config,
+		name:    u.String(),
+		timeout: defaultWebhookTimeout,
+		retries: defaultWebhookRetries,
+		events:  make(map[string]bool),
+		queue:   make(chan webhookPayload, webhookQueueSize),
+	}
+	if h.config.Method == "" {
+		h.config.Method = defaultWebhookMethod
+	}
+	if config.Body != "" {
+		h.body, err = template.New(h.name).Funcs(template.FuncMap{"json": templateJSON}).Parse(config.Body)
+		if err != nil {
+			return nil, fmt.Errorf("webhook %s body: %w", h.name, err)
+		}
+	}
+	if config.Timeout != "" {
+		h.timeout, err = time.ParseDuration(config.Timeout)
+		if err != nil || h.timeout <= 0 {
+			return nil, fmt.Errorf("webhook %s: invalid timeout %q", h.name, config.Timeout)
+		}
+	}
+	if config.Retries != nil {
+		if *config.Retries < 0 {
+			return nil, fmt.Errorf("webhook %s: retries must not be negative", h.name)
+		}
+		h.retries = *config.Retries
+	}
+
+	if len(h.config.Events) == 0 {
+		h.config.Events = []string{string(StateFired)}
+	}
+	for _, e := range h.config.Events {
+		if !webhookEvents[e] {
+			return nil, fmt.Errorf("webhook %s: unknown event %q", h.name, e)
+		}
+		h.events[e] = true
+	}
+	if len(config.Timers) > 0 {
+		h.timers = make(map[string]bool)
+		for _, name := range config.Timers {
+			h.timers[name] = true
+		}
+	}
+	return h, nil
+}
+
+// templateJSON formats v as JSON in body templates, e.g. {{json .Data}}.
+func templateJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// newWebhookSet validates configs.
+func newWebhookSet(configs []webhookConfig) (*webhookSet, error) {
+	ws := &webhookSet{client: &http.Client{}}
+	for _, config := range configs {
+		h, err := newWebhook(config)
+		if err != nil {
+			return nil, err
+		}
+		ws.hooks = append(ws.hooks, h)
+	}
+	return ws, nil
+}
+
+// Handle queues e for the webhooks subscribed to it, without blocking. It is
+// registered with eventHub.Listen.
+func (ws *webhookSet) Handle(e timerEvent) {
+	payload := webhookPayload{Event: e.Type, Timer: e.Timer, Time: time.Now().Format(time.RFC3339), Data: e.Data}
+	for _, h := range ws.hooks {
+		if !h.events[e.Type] || (h.timers != nil && e.Timer != "" && !h.timers[e.Timer]) {
+			continue
+		}
+		select {
+		case h.queue <- payload:
+		default:
+			log.Printf("Webhook %s queue full, dropping %s event", h.name, e.Type)
+			h.recordFailure(fmt.Errorf("queue full, dropped %s event", e.Type))
+		}
+	}
+}
+
+// Run delivers queued events until ctx is cancelled, abandoning deliveries in
+// progress. It runs a goroutine per webhook and returns once all have stopped.
+func (ws *webhookSet) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, h := range ws.hooks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case payload := <-h.queue:
+					ws.deliver(ctx, h, payload)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// deliver sends payload to h, retrying with exponential backoff.
+func (ws *webhookSet) deliver(ctx context.Context, h *webhook, payload webhookPayload) {
+	body, err := h.render(payload)
+	if err != nil {
+		log.Printf("Webhook %s failed to render %s event: %s", h.name, payload.Event, err)
+		h.recordFailure(err)
+		return
+	}
+
+	backoff := webhookBackoff
+	for attempt := 0; ; attempt++ {
+		err = ws.send(ctx, h, body)
+		if err == nil {
+			log.Printf("Webhook %s delivered %s event", h.name, payload.Event)
+			h.recordSuccess()
+			return
+		}
+		if attempt >= h.retries || ctx.Err() != nil {
+			break
+		}
+		log.Printf("Webhook %s failed, retrying in %s: %s", h.name, backoff, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+		}
+		backoff = min(backoff*2, webhookMaxBackoff)
+	}
+	log.Printf("Webhook %s failed to deliver %s event: %s", h.name, payload.Event, err)
+	h.recordFailure(err)
+}
+
+// render returns the request body for payload.
+func (h *webhook) render(payload webhookPayload) ([]byte, error) {
+	if h.body == nil {
+		return json.Marshal(payload)
+	}
+	var b bytes.Buffer
+	if err := h.body.Execute(&b, payload); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// send makes one attempt to call h with body. Responses other than 2xx are errors.
+func (ws *webhookSet) send(ctx context.Context, h *webhook, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, h.config.Method, h.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "hktimer")
+	for k, v := range h.config.Headers {
+		req.Header.Set(k, v)
+	}
+	if h.config.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(webhookTimestampHeader, timestamp)
+		req.Header.Set(webhookSignatureHeader, webhookSignature(h.config.Secret, timestamp, body))
+	}
+
+	res, err := ws.client.Do(req)
+	if err != nil {
+		// Drop the URL from the error, it may hold credentials
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return urlErr.Err
+		}
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("status %s", res.Status)
+	}
+	return nil
+}
+
+// webhookSignature returns the signature header value for body sent at
+// timestamp: the hex HMAC-SHA256 with secret of the timestamp, a dot and the
+// body, so receivers can reject replayed requests.
+func webhookSignature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (h *webhook) recordSuccess() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.delivered++
+	h.lastSuccess = time.Now()
+}
+
+func (h *webhook) recordFailure(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.failed++
+	h.lastFailure = time.Now()
+	h.lastError = err.Error()
+}
+
+// Status returns the delivery status of every webhook.
+func (ws *webhookSet) Status() []outputWebhook {
+	list := make([]outputWebhook, 0, len(ws.hooks))
+	for _, h := range ws.hooks {
+		h.mu.Lock()
+		out := outputWebhook{
+			URL:         h.name,
+			Events:      h.config.Events,
+			Delivered:   h.delivered,
+			Failed:      h.failed,
+			LastSuccess: formatTime(h.lastSuccess),
+			LastFailure: formatTime(h.lastFailure),
+		}
+		if h.lastError != "" {
+			lastError := h.lastError
+			out.LastError = &lastError
+		}
+		h.mu.Unlock()
+		list = append(list, out)
+	}
+	return list
+}
+
+// registerWebhookRoutes registers the webhook status at /webhooks.
+func registerWebhookRoutes(mux hap.ServeMux, ws *webhookSet) {
+	mux.HandleFunc("/webhooks", webhooksHandler(ws))
+}
+
+// webhooksHandler serves the delivery status of the webhooks in ws.
+func webhooksHandler(ws *webhookSet) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			log.Printf("HTTP request not supported")
+			http.Error(res, "Not supported", http.StatusNotImplemented)
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(res).Encode(ws.Status())
+	}
+}
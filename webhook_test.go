@@ -0,0 +1,276 @@
+package main
+
+import (
+	"github.com/brutella/hap"
+
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookRequest is a request received by a test webhook server
+type webhookRequest struct {
+	method string
+	header http.Header
+	body   string
+}
+
+// newWebhookServer starts a server recording requests and answering with the
+// status codes in order, then 200
+func newWebhookServer(t *testing.T, codes ...int) (*httptest.Server, <-chan webhookRequest) {
+	t.Helper()
+	requests := make(chan webhookRequest, 16)
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		requests <- webhookRequest{req.Method, req.Header, string(body)}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if len(codes) > 0 {
+			res.WriteHeader(codes[0])
+			codes = codes[1:]
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+// runWebhooks starts delivering for ws until the test ends
+func runWebhooks(t *testing.T, ws *webhookSet) {
+	t.Helper()
+	backoff := webhookBackoff
+	webhookBackoff = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		ws.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		webhookBackoff = backoff
+	})
+}
+
+// nextWebhookRequest returns the next request, failing after a second
+func nextWebhookRequest(t *testing.T, requests <-chan webhookRequest) webhookRequest {
+	t.Helper()
+	select {
+	case req := <-requests:
+		return req
+	case <-time.After(time.Second):
+		t.Fatal("No webhook request received")
+	}
+	return webhookRequest{}
+}
+
+// waitWebhookStatus waits until the first webhook has delivered or failed n events
+func waitWebhookStatus(t *testing.T, ws *webhookSet, n int) outputWebhook {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		st := ws.Status()[0]
+		if st.Delivered+st.Failed >= n || time.Now().After(deadline) {
+			return st
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestWebhookDelivery verifies the default body and signature of a fire event
+func TestWebhookDelivery(t *testing.T) {
+	server, requests := newWebhookServer(t)
+	ws, err := newWebhookSet([]webhookConfig{{
+		URL:     server.URL + "/hook?token=abc",
+		Headers: map[string]string{"X-Test": "1"},
+		Secret:  "s3cret",
+	}})
+	if err != nil {
+		t.Fatalf("newWebhookSet failed: %v", err)
+	}
+	runWebhooks(t, ws)
+
+	// Only fire events are sent by default
+	ws.Handle(timerEvent{Type: string(StateArmed), Timer: "kids"})
+	ws.Handle(timerEvent{Type: string(StateFired), Timer: "kids", Data: outputTimer{State: StateFired}})
+
+	req := nextWebhookRequest(t, requests)
+	if req.method != http.MethodPost || req.header.Get("X-Test") != "1" {
+		t.Errorf("Request %s with X-Test %q, expected POST with header", req.method, req.header.Get("X-Test"))
+	}
+	var payload struct {
+		Event string      `json:"event"`
+		Timer string      `json:"timer"`
+		Data  outputTimer `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(req.body), &payload); err != nil {
+		t.Fatalf("Failed to parse body %q: %v", req.body, err)
+	}
+	if payload.Event != string(StateFired) || payload.Timer != "kids" || payload.Data.State != StateFired {
+		t.Errorf("Payload = %+v, expected fired event of kids", payload)
+	}
+
+	timestamp := req.header.Get(webhookTimestampHeader)
+	if sig := req.header.Get(webhookSignatureHeader); sig != webhookSignature("s3cret", timestamp, []byte(req.body)) {
+		t.Errorf("Signature %q doesn't match the body", sig)
+	}
+
+	st := waitWebhookStatus(t, ws, 1)
+	if st.Delivered != 1 || st.LastSuccess == nil || st.URL != server.URL+"/hook" {
+		t.Errorf("Status = %+v, expected one delivery to the URL without query", st)
+	}
+}
+
+// TestWebhookTemplate verifies body templates, methods and event and timer filters
+func TestWebhookTemplate(t *testing.T) {
+	server, requests := newWebhookServer(t)
+	ws, err := newWebhookSet([]webhookConfig{{
+		URL:    server.URL,
+		Method: http.MethodPut,
+		Body:   `{{.Event}} {{.Timer}} {{json .Data}}`,
+		Events: []string{string(StateArmed), string(StateCancelled), pairingPaired},
+		Timers: []string{"kids"},
+	}})
+	if err != nil {
+		t.Fatalf("newWebhookSet failed: %v", err)
+	}
+	runWebhooks(t, ws)
+
+	ws.Handle(timerEvent{Type: string(StateArmed), Timer: "guest", Data: 1})
+	ws.Handle(timerEvent{Type: string(StateArmed), Timer: "kids", Data: 2})
+	ws.Handle(timerEvent{Type: pairingPaired, Data: outputPairing{ID: "A1", Admin: true}})
+
+	if req := nextWebhookRequest(t, requests); req.method != http.MethodPut || req.body != "armed kids 2" {
+		t.Errorf("Request %s %q, expected PUT \"armed kids 2\"", req.method, req.body)
+	}
+	if req := nextWebhookRequest(t, requests); req.body != `paired  {"id":"A1","admin":true}` {
+		t.Errorf("Request body %q, expected pairing event", req.body)
+	}
+	select {
+	case req := <-requests:
+		t.Errorf("Unexpected request %q", req.body)
+	default:
+	}
+}
+
+// TestWebhookRetry verifies failed calls are retried and given up on
+func TestWebhookRetry(t *testing.T) {
+	server, requests := newWebhookServer(t, http.StatusInternalServerError, http.StatusBadGateway)
+	retries := 1
+	ws, err := newWebhookSet([]webhookConfig{{URL: server.URL, Retries: &retries}})
+	if err != nil {
+		t.Fatalf("newWebhookSet failed: %v", err)
+	}
+	runWebhooks(t, ws)
+
+	ws.Handle(timerEvent{Type: string(StateFired)})
+	nextWebhookRequest(t, requests)
+	nextWebhookRequest(t, requests)
+	st := waitWebhookStatus(t, ws, 1)
+	if st.Failed != 1 || st.LastError == nil || !strings.Contains(*st.LastError, "502") {
+		t.Errorf("Status = %+v, expected a failure with status 502", st)
+	}
+
+	// The server now succeeds on the first attempt
+	ws.Handle(timerEvent{Type: string(StateFired)})
+	nextWebhookRequest(t, requests)
+	if st := waitWebhookStatus(t, ws, 2); st.Delivered != 1 {
+		t.Errorf("Status = %+v, expected one delivery", st)
+	}
+}
+
+// TestWebhookTimeout verifies attempts are cut off after the timeout
+func TestWebhookTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		select {
+		case <-release:
+		case <-req.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	retries := 0
+	ws, err := newWebhookSet([]webhookConfig{{URL: server.URL, Timeout: "50ms", Retries: &retries}})
+	if err != nil {
+		t.Fatalf("newWebhookSet failed: %v", err)
+	}
+	runWebhooks(t, ws)
+
+	ws.Handle(timerEvent{Type: string(StateFired)})
+	if st := waitWebhookStatus(t, ws, 1); st.Failed != 1 {
+		t.Errorf("Status = %+v, expected a failure after the timeout", st)
+	}
+}
+
+// TestNewWebhookInvalid verifies configuration errors
+func TestNewWebhookInvalid(t *testing.T) {
+	negative := -1
+	invalid := []webhookConfig{
+		{URL: ""},
+		{URL: "ftp://example.com/"},
+		{URL: "/relative"},
+		{URL: "http://example.com/", Body: "{{.Event"},
+		{URL: "http://example.com/", Events: []string{"exploded"}},
+		{URL: "http://example.com/", Timeout: "soon"},
+		{URL: "http://example.com/", Timeout: "0s"},
+		{URL: "http://example.com/", Retries: &negative},
+	}
+	for _, config := range invalid {
+		if _, err := newWebhook(config); err == nil {
+			t.Errorf("newWebhook(%+v) succeeded, expected error", config)
+		}
+	}
+}
+
+// TestLoadWebhooks verifies the configuration file is parsed strictly
+func TestLoadWebhooks(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "webhooks.json")
+	os.WriteFile(path, []byte(`[{"url": "https://example.com/fired", "events": ["fired", "armed"], "retries": 5}]`), 0o600)
+
+	configs, err := loadWebhooks(path)
+	if err != nil {
+		t.Fatalf("loadWebhooks failed: %v", err)
+	}
+	if len(configs) != 1 || configs[0].URL != "https://example.com/fired" || len(configs[0].Events) != 2 || *configs[0].Retries != 5 {
+		t.Errorf("Configs = %+v", configs)
+	}
+
+	os.WriteFile(path, []byte(`[{"url": "https://example.com/", "retry": 5}]`), 0o600)
+	if _, err := loadWebhooks(path); err == nil {
+		t.Error("loadWebhooks accepted an unknown field")
+	}
+}
+
+// TestWebhookEventsFromTimer verifies timer changes reach the webhooks through the event hub
+func TestWebhookEventsFromTimer(t *testing.T) {
+	server, requests := newWebhookServer(t)
+	ws, _ := newWebhookSet([]webhookConfig{{URL: server.URL}})
+	runWebhooks(t, ws)
+
+	clock := newFakeClock(testEpoch)
+	events := newEventHub()
+	events.Listen(ws.Handle)
+	nt := newNamedTimer(defaultTimerName, hap.NewMemStore(), timerConfig{Clock: clock, Events: events})
+
+	nt.Timer.Reset(time.Minute)
+	clock.Advance(time.Minute)
+
+	req := nextWebhookRequest(t, requests)
+	if !strings.Contains(req.body, `"event":"fired"`) || !strings.Contains(req.body, `"timer":"timer"`) {
+		t.Errorf("Body %q, expected fired event of timer", req.body)
+	}
+}